@@ -22,11 +22,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	clihandler "github.com/RockX-SG/frost-dkg-demo/internal/cli"
 	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
 	"github.com/urfave/cli/v2"
 )
 
@@ -35,6 +38,15 @@ const serviceName = "cli"
 var version string
 
 func main() {
+	if _, err := tlsconfig.ClientConfigFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), serviceName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	h := clihandler.New(logger.New(serviceName))
 	app := &cli.App{
 		Name:  "rockx-dkg-cli",
@@ -42,13 +54,22 @@ func main() {
 		Commands: []*cli.Command{
 			h.CommandKeygen(),
 			h.CommandResharing(),
+			h.CommandRefresh(),
+			h.CommandRetireShares(),
 			h.CommandGetDKGResults(),
 			h.CommandGenerateDepositData(),
 			h.CommandGetKeyshares(),
+			h.CommandVoluntaryExit(),
+			h.CommandBuilderRegistration(),
+			h.CommandReconstructKey(),
+			h.CommandSplitKey(),
+			h.CommandGenerateRegisterTx(),
 		},
 		Version: version,
 	}
-	if err := app.Run(os.Args); err != nil {
+	err = app.Run(os.Args)
+	shutdownTracing(context.Background())
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -22,84 +22,158 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 
 	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
 	"github.com/RockX-SG/frost-dkg-demo/internal/ping"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
 	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
 )
 
 const serviceName = "messenger"
 
 var (
-	version  string
-	httpAddr string
+	version             string
+	httpAddr            string
+	adminAddr           string
+	healthCheckInterval time.Duration
+	subscriberTimeout   time.Duration
+	recordDir           string
+	shutdownGracePeriod time.Duration
+	tlsOpts             = &tlsconfig.ServerOptions{}
 )
 
 func init() {
 	flag.StringVar(&httpAddr, "http-addr", "0.0.0.0:3000", "host:port of the application")
+	flag.DurationVar(&healthCheckInterval, "health-check-interval", messenger.DefaultHealthCheckInterval, "interval between health checks of registered nodes")
+	flag.DurationVar(&subscriberTimeout, "subscriber-timeout", messenger.DefaultSubscriberTimeout, "a node the messenger hasn't reached for this long is unhealthy and can't join new topics, 0 disables the check")
+	flag.StringVar(&adminAddr, "admin-addr", "", "host:port the admin endpoints are served on without authentication, e.g. 127.0.0.1:3001. Disabled if empty")
+	flag.StringVar(&recordDir, "record-dir", "", "if set, messages of every ceremony are recorded to a transcript file in this directory")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", messenger.DefaultShutdownGracePeriod, "on SIGINT or SIGTERM, time given to deliver the queued messages before exiting")
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "server certificate, serves https if set")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "server certificate key")
+	flag.StringVar(&tlsOpts.ClientCAFile, "tls-client-ca", "", "CA bundle of operator certificates. If set, nodes must present an operator certificate (mTLS)")
 }
 
 func main() {
 	flag.Parse()
 
 	log := logger.New(serviceName)
-	m := &messenger.Messenger{
-		Topics: map[string]*messenger.Topic{
-			messenger.DefaultTopic: {
-				Name:        messenger.DefaultTopic,
-				Subscribers: make(map[string]*messenger.Subscriber),
-			},
-		},
-		Incoming: make(chan *messenger.Message, 50),
-		Data:     make(map[string]*messenger.DataStore),
+	if _, err := tlsconfig.ClientConfigFromEnv(); err != nil {
+		log.Errorf("Main: invalid client tls config: %s", err.Error())
+		panic(err)
 	}
-	m.WithLogger(log)
+	if tlsOpts.ClientCAFile != "" && !tlsOpts.Enabled() {
+		panic("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), serviceName)
+	if err != nil {
+		log.Errorf("Main: failed to set up tracing: %s", err.Error())
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
 
 	worker := workers.NewRunner(log)
 	go worker.Run()
 
+	m := messenger.New(log, worker)
+	m.Webhooks = messenger.NewWebhookNotifier(log)
+	m.Health = messenger.NewHealthChecker(log, healthCheckInterval, subscriberTimeout)
+	if recordDir != "" {
+		if err := os.MkdirAll(recordDir, 0700); err != nil {
+			panic(err)
+		}
+		m.RecordDir = recordDir
+	}
+
 	worker.AddJob(&workers.Job{
-		ID: fmt.Sprintf("TOPIC__%s", messenger.DefaultTopic),
-		Fn: m.ProcessIncomingMessageWorker,
+		ID:      "HEALTH_CHECK",
+		Fn:      m.Health.HealthCheckWorker,
+		Restart: workers.RestartOnFailure,
 	})
 
 	r := gin.Default()
 	r.SetTrustedProxies(nil)
 
 	r.Use(logger.GinLogger(log))
+	r.Use(tracing.Middleware())
 
-	InitializeAPIEndpoints(r, m, worker)
+	InitializeAPIEndpoints(r, m, tlsOpts.ClientCAFile != "")
 
-	log.Infof("Starting %s on %s", serviceName, httpAddr)
-	panic(r.Run(httpAddr))
-}
+	srv, err := tlsconfig.NewServer(httpAddr, r, tlsOpts)
+	if err != nil {
+		log.Errorf("Main: invalid server tls config: %s", err.Error())
+		panic(err)
+	}
 
-func InitializeAPIEndpoints(r *gin.Engine, m *messenger.Messenger, w *workers.Runner) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- tlsconfig.Serve(srv)
+	}()
+	log.Infof("Starting %s on %s tls=%t mtls=%t", serviceName, httpAddr, tlsOpts.Enabled(), tlsOpts.ClientCAFile != "")
+
+	var adminSrv *http.Server
+	if adminAddr != "" {
+		admin := gin.New()
+		admin.Use(gin.Recovery())
+		InitializeAdminEndpoints(admin, worker)
+		adminSrv = &http.Server{Addr: adminAddr, Handler: admin}
+		go func() {
+			serveErr <- adminSrv.ListenAndServe()
+		}()
+		log.Infof("Serving admin endpoints on %s", adminAddr)
+	}
 
-	// Message Topic - CRUD APIs
-	topicsGroup := r.Group("/topics")
-	{
-		topicsGroup.GET("", m.GetTopics())
-		topicsGroup.POST("", m.CreateOrUpdateTopic())
-		topicsGroup.GET("/:topic_name", m.GetTopic())
-		topicsGroup.DELETE("/:topic_name", m.DeleteTopic())
+	select {
+	case err := <-serveErr:
+		panic(err)
+	case <-ctx.Done():
 	}
+	shutdown(log, srv, adminSrv, m, worker)
+}
 
-	// DKG Node Registration
-	r.POST("/register_node", m.HandleNodeRegistration(w))
+// shutdown refuses new topics, delivers the queued messages and stops the
+// workers within the grace period
+func shutdown(log *logrus.Logger, srv, adminSrv *http.Server, m *messenger.Messenger, worker *workers.Runner) {
+	log.Infof("Main: shutting down, waiting up to %s for queued messages", shutdownGracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer cancel()
 
-	// DKG network layer actions
-	r.POST("/publish", m.HandlePublish())
-	r.POST("/stream/dkgoutput", m.HandleStreamDKGOutput())
-	r.POST("/stream/dkgblame", m.HandleStreamDKGBlame())
-	r.GET("/data/:request_id", m.HandleGetData())
+	if err := m.Drain(ctx); err != nil {
+		log.Warnf("Main: shutting down before all messages were delivered: %s", err.Error())
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warnf("Main: failed to shut down the http server: %s", err.Error())
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			log.Warnf("Main: failed to shut down the admin server: %s", err.Error())
+		}
+	}
+	if err := worker.Shutdown(ctx); err != nil {
+		log.Warnf("Main: workers didn't stop in time: %s", err.Error())
+	}
+	log.Infof("Main: %s stopped", serviceName)
+}
+
+func InitializeAPIEndpoints(r *gin.Engine, m *messenger.Messenger, requireNodeCert bool) {
+	m.RegisterRoutes(r, requireNodeCert)
 
 	// Service Health and Monitoring APIs
 	r.GET("/ping", ping.HandlePing)
@@ -110,3 +184,12 @@ func InitializeAPIEndpoints(r *gin.Engine, m *messenger.Messenger, w *workers.Ru
 		})
 	})
 }
+
+// InitializeAdminEndpoints adds the routes served on -admin-addr, which has no
+// authentication and must not be reachable from outside
+func InitializeAdminEndpoints(r *gin.Engine, w *workers.Runner) {
+	// status of the topic, delivery and health check workers
+	r.GET("/admin/jobs", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, w.Jobs())
+	})
+}
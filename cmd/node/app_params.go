@@ -23,81 +23,60 @@ package main
 
 import (
 	"crypto/rsa"
-	"encoding/base64"
 	"fmt"
-	"os"
-	"strconv"
+	"strings"
+	"time"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/RockX-SG/frost-dkg-demo/internal/policy"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
 	"github.com/bloxapp/ssv-spec/types"
 )
 
+// AppParams is the validated node config, see loadParams
 type AppParams struct {
 	HttpAddress        string
+	BroadcastAddress   string
+	MessengerAddress   string
+	DataDir            string
 	OperatorID         types.OperatorID
 	OperatorPrivateKey *rsa.PrivateKey
+	HeartbeatInterval  time.Duration
+	// ShutdownGracePeriod is the time running ceremonies get to finish on shutdown
+	ShutdownGracePeriod time.Duration
+	TLS                 *tlsconfig.ServerOptions
+	Network             string
+	P2PListenAddrs      []string
+	P2PBootstrap        []string
+	Registry            *store.RegistryConfig
+	// Policy is nil without a policy file, the node then joins every ceremony
+	Policy *policy.Policy
 }
 
-func (params *AppParams) loadFromEnv() error {
-	params.loadOperatorID()
-	params.loadHttpAddress()
-	return params.loadOperatorPrivateKey()
-}
+const (
+	NetworkMessenger = "messenger"
+	NetworkP2P       = "p2p"
+)
 
 func (params *AppParams) print() string {
 	return fmt.Sprintf(
-		"operatorID=%d http_addr=%s",
+		"operatorID=%d http_addr=%s tls=%t network=%s data_dir=%s registry=%s policy=%t",
 		params.OperatorID,
 		params.HttpAddress,
+		params.TLS.Enabled(),
+		params.Network,
+		params.DataDir,
+		params.Registry.Network,
+		params.Policy != nil,
 	)
 }
 
-func (params *AppParams) loadOperatorID() {
-	operatorID, err := strconv.ParseUint(os.Getenv("NODE_OPERATOR_ID"), 10, 32)
-	if err != nil {
-		panic(err)
-	}
-	params.OperatorID = types.OperatorID(operatorID)
-}
-
-func (params *AppParams) loadHttpAddress() {
-	nodeAddr := os.Getenv("NODE_ADDR")
-	if nodeAddr == "" {
-		nodeAddr = "0.0.0.0:8080"
-	}
-	params.HttpAddress = nodeAddr
-}
-
-func (params *AppParams) loadOperatorPrivateKey() error {
-	passwordFilePath := os.Getenv("OPERATOR_PRIVATE_KEY_PASSWORD_PATH")
-	if passwordFilePath == "" {
-		encodedKey := os.Getenv("OPERATOR_PRIVATE_KEY")
-		if encodedKey == "" {
-			return fmt.Errorf("missing operator private key in app env")
-		}
-		decodedKey, err := base64.StdEncoding.DecodeString(encodedKey)
-		if err != nil {
-			return fmt.Errorf("failed to decode base64 encoded operator private key: %w", err)
-		}
-		operatorPrivateKey, err := types.PemToPrivateKey(decodedKey)
-		if err != nil {
-			return fmt.Errorf("failed to convert pem block to rsa private key %w", err)
-		}
-		params.OperatorPrivateKey = operatorPrivateKey
-	} else {
-		lockedPrivateKey, err := os.ReadFile(os.Getenv("OPERATOR_PRIVATE_KEY_PATH"))
-		if err != nil {
-			return fmt.Errorf("failed to read operator private key file %w", err)
-		}
-		keyPassword, err := os.ReadFile(passwordFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to read operator private key password file %w", err)
-		}
-		privateKey, err := utils.UnlockRSAJSON(lockedPrivateKey, string(keyPassword))
-		if err != nil {
-			return fmt.Errorf("failed to unlock operator private key %w", err)
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
 		}
-		params.OperatorPrivateKey = privateKey
 	}
-	return nil
+	return list
 }
@@ -0,0 +1,443 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/p2p"
+	"github.com/RockX-SG/frost-dkg-demo/internal/policy"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvConfigFile = "NODE_CONFIG_FILE"
+
+	DefaultHttpAddress = "0.0.0.0:8080"
+	DefaultDataDir     = "/frost-dkg-data"
+)
+
+// Config is the node config file, either yaml or toml depending on the file
+// extension. Env vars override the file and flags override both.
+type Config struct {
+	OperatorID       uint32 `yaml:"operator_id" toml:"operator_id"`
+	HttpAddress      string `yaml:"http_addr" toml:"http_addr"`
+	BroadcastAddress string `yaml:"broadcast_addr" toml:"broadcast_addr"`
+	MessengerAddress string `yaml:"messenger_addr" toml:"messenger_addr"`
+	DataDir          string `yaml:"data_dir" toml:"data_dir"`
+	// PolicyFile decides which ceremonies the node joins, see internal/policy
+	PolicyFile  string            `yaml:"policy_file" toml:"policy_file"`
+	OperatorKey OperatorKeyConfig `yaml:"operator_key" toml:"operator_key"`
+	TLS         TLSConfig         `yaml:"tls" toml:"tls"`
+	Network     NetworkConfig     `yaml:"network" toml:"network"`
+	Registry    RegistryConfig    `yaml:"registry" toml:"registry"`
+	Timeouts    TimeoutsConfig    `yaml:"timeouts" toml:"timeouts"`
+}
+
+// OperatorKeyConfig is either the base64 encoded pem key or a key file locked
+// with the password in PasswordPath
+type OperatorKeyConfig struct {
+	Key          string `yaml:"key" toml:"key"`
+	Path         string `yaml:"path" toml:"path"`
+	PasswordPath string `yaml:"password_path" toml:"password_path"`
+}
+
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile      string `yaml:"key_file" toml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+}
+
+type NetworkConfig struct {
+	Type           string   `yaml:"type" toml:"type"`
+	P2PListenAddrs []string `yaml:"p2p_listen_addrs" toml:"p2p_listen_addrs"`
+	P2PBootstrap   []string `yaml:"p2p_bootstrap" toml:"p2p_bootstrap"`
+}
+
+type RegistryConfig struct {
+	Network            string `yaml:"network" toml:"network"`
+	HardcodedOperators bool   `yaml:"hardcoded_operators" toml:"hardcoded_operators"`
+}
+
+// TimeoutsConfig holds durations such as 15s or 1m
+type TimeoutsConfig struct {
+	HeartbeatInterval string `yaml:"heartbeat_interval" toml:"heartbeat_interval"`
+	Registry          string `yaml:"registry" toml:"registry"`
+	// ShutdownGracePeriod is the time running ceremonies get to finish on SIGINT or SIGTERM
+	ShutdownGracePeriod string `yaml:"shutdown_grace_period" toml:"shutdown_grace_period"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		HttpAddress:      DefaultHttpAddress,
+		MessengerAddress: messenger.DefaultMessengerAddr,
+		DataDir:          DefaultDataDir,
+		Network: NetworkConfig{
+			Type:           NetworkMessenger,
+			P2PListenAddrs: []string{p2p.DefaultListenAddr},
+		},
+		Registry: RegistryConfig{
+			Network: "mainnet",
+		},
+		Timeouts: TimeoutsConfig{
+			HeartbeatInterval:   node.DefaultHeartbeatInterval.String(),
+			Registry:            store.DefaultRegistryTimeout.String(),
+			ShutdownGracePeriod: node.DefaultShutdownGracePeriod.String(),
+		},
+	}
+}
+
+// readConfigFile decodes the file over the defaults. Unknown keys are rejected
+// so that a typo doesn't silently fall back to a default.
+func readConfigFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		// an empty file is a valid config of defaults
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s, must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// applyEnv overrides the config with the env vars the node was configured with
+// before the config file existed
+func (cfg *Config) applyEnv() []error {
+	errs := make([]error, 0)
+
+	if v := os.Getenv("NODE_OPERATOR_ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid NODE_OPERATOR_ID %s: %w", v, err))
+		}
+		cfg.OperatorID = uint32(id)
+	}
+	setFromEnv(&cfg.HttpAddress, "NODE_ADDR")
+	setFromEnv(&cfg.BroadcastAddress, "NODE_BROADCAST_ADDR")
+	setFromEnv(&cfg.MessengerAddress, "MESSENGER_SRV_ADDR")
+	setFromEnv(&cfg.DataDir, "NODE_DATA_DIR")
+	setFromEnv(&cfg.PolicyFile, "NODE_POLICY_FILE")
+
+	setFromEnv(&cfg.OperatorKey.Key, "OPERATOR_PRIVATE_KEY")
+	setFromEnv(&cfg.OperatorKey.Path, "OPERATOR_PRIVATE_KEY_PATH")
+	setFromEnv(&cfg.OperatorKey.PasswordPath, "OPERATOR_PRIVATE_KEY_PASSWORD_PATH")
+
+	setFromEnv(&cfg.TLS.CertFile, "NODE_TLS_CERT_FILE")
+	setFromEnv(&cfg.TLS.KeyFile, "NODE_TLS_KEY_FILE")
+	setFromEnv(&cfg.TLS.ClientCAFile, "NODE_TLS_CLIENT_CA_FILE")
+
+	setFromEnv(&cfg.Network.Type, "NODE_NETWORK")
+	if v := os.Getenv("NODE_P2P_LISTEN_ADDR"); v != "" {
+		cfg.Network.P2PListenAddrs = splitList(v)
+	}
+	if v := os.Getenv("NODE_P2P_BOOTSTRAP"); v != "" {
+		cfg.Network.P2PBootstrap = splitList(v)
+	}
+
+	setFromEnv(&cfg.Registry.Network, "OPERATOR_REGISTRY_NETWORK")
+	if v := os.Getenv("USE_HARDCODED_OPERATORS"); v != "" {
+		hardcoded, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid USE_HARDCODED_OPERATORS %s: %w", v, err))
+		}
+		cfg.Registry.HardcodedOperators = hardcoded
+	}
+
+	setFromEnv(&cfg.Timeouts.HeartbeatInterval, "NODE_HEARTBEAT_INTERVAL")
+	setFromEnv(&cfg.Timeouts.Registry, "NODE_REGISTRY_TIMEOUT")
+	setFromEnv(&cfg.Timeouts.ShutdownGracePeriod, "NODE_SHUTDOWN_GRACE_PERIOD")
+	return errs
+}
+
+func setFromEnv(value *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*value = v
+	}
+}
+
+// flagOverrides are the config values that can be set on the command line
+type flagOverrides struct {
+	configFile       string
+	operatorID       uint
+	httpAddress      string
+	broadcastAddress string
+	messengerAddress string
+	dataDir          string
+	policyFile       string
+	network          string
+}
+
+func newFlagSet(name string, overrides *flagOverrides) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&overrides.configFile, "config", os.Getenv(EnvConfigFile), "yaml or toml config file, env vars and flags override its values")
+	fs.UintVar(&overrides.operatorID, "operator-id", 0, "ID of the operator run by this node")
+	fs.StringVar(&overrides.httpAddress, "http-addr", "", "address the node api listens on")
+	fs.StringVar(&overrides.broadcastAddress, "broadcast-addr", "", "url of the node api registered with the messenger")
+	fs.StringVar(&overrides.messengerAddress, "messenger-addr", "", "url of the messenger")
+	fs.StringVar(&overrides.dataDir, "data-dir", "", "badger data dir")
+	fs.StringVar(&overrides.policyFile, "policy-file", "", "yaml or toml file of the ceremonies the node joins")
+	fs.StringVar(&overrides.network, "network", "", "messenger or p2p")
+	return fs
+}
+
+// applyFlags overrides the config with the flags given on the command line
+func (cfg *Config) applyFlags(fs *flag.FlagSet, overrides *flagOverrides) {
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "operator-id":
+			cfg.OperatorID = uint32(overrides.operatorID)
+		case "http-addr":
+			cfg.HttpAddress = overrides.httpAddress
+		case "broadcast-addr":
+			cfg.BroadcastAddress = overrides.broadcastAddress
+		case "messenger-addr":
+			cfg.MessengerAddress = overrides.messengerAddress
+		case "data-dir":
+			cfg.DataDir = overrides.dataDir
+		case "policy-file":
+			cfg.PolicyFile = overrides.policyFile
+		case "network":
+			cfg.Network.Type = overrides.network
+		}
+	})
+}
+
+// loadParams builds the app params from the config file, the env and the flags.
+// Every problem of the config is reported, not only the first one.
+func loadParams(name string, args []string) (*AppParams, error) {
+	overrides := &flagOverrides{}
+	fs := newFlagSet(name, overrides)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	if overrides.configFile != "" {
+		if err := readConfigFile(cfg, overrides.configFile); err != nil {
+			return nil, err
+		}
+	}
+	errs := cfg.applyEnv()
+	cfg.applyFlags(fs, overrides)
+
+	params, validationErrs := cfg.params()
+	errs = append(errs, validationErrs...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return params, nil
+}
+
+func (cfg *Config) params() (*AppParams, []error) {
+	errs := make([]error, 0)
+	params := &AppParams{
+		OperatorID:       types.OperatorID(cfg.OperatorID),
+		HttpAddress:      cfg.HttpAddress,
+		BroadcastAddress: cfg.BroadcastAddress,
+		MessengerAddress: cfg.MessengerAddress,
+		DataDir:          cfg.DataDir,
+		Network:          cfg.Network.Type,
+		P2PListenAddrs:   cfg.Network.P2PListenAddrs,
+		P2PBootstrap:     cfg.Network.P2PBootstrap,
+		TLS: &tlsconfig.ServerOptions{
+			CertFile:          cfg.TLS.CertFile,
+			KeyFile:           cfg.TLS.KeyFile,
+			ClientCAFile:      cfg.TLS.ClientCAFile,
+			RequireClientCert: true,
+		},
+		Registry: &store.RegistryConfig{
+			Network:   cfg.Registry.Network,
+			Hardcoded: cfg.Registry.HardcodedOperators,
+		},
+	}
+
+	if cfg.OperatorID == 0 {
+		errs = append(errs, fmt.Errorf("operator_id is required"))
+	}
+	if _, _, err := net.SplitHostPort(cfg.HttpAddress); err != nil {
+		errs = append(errs, fmt.Errorf("invalid http_addr %s: %w", cfg.HttpAddress, err))
+	}
+	if cfg.DataDir == "" {
+		errs = append(errs, fmt.Errorf("data_dir is required"))
+	}
+
+	switch cfg.Network.Type {
+	case NetworkMessenger:
+		if err := validateURL(cfg.MessengerAddress); err != nil {
+			errs = append(errs, fmt.Errorf("invalid messenger_addr: %w", err))
+		}
+		if err := validateURL(cfg.BroadcastAddress); err != nil {
+			errs = append(errs, fmt.Errorf("invalid broadcast_addr, the messenger delivers messages to it: %w", err))
+		}
+	case NetworkP2P:
+		if len(cfg.Network.P2PListenAddrs) == 0 {
+			errs = append(errs, fmt.Errorf("network.p2p_listen_addrs is required for the p2p network"))
+		}
+		if len(cfg.Network.P2PBootstrap) == 0 {
+			errs = append(errs, fmt.Errorf("network.p2p_bootstrap is required for the p2p network"))
+		}
+		for _, addr := range cfg.Network.P2PBootstrap {
+			if _, err := peer.AddrInfoFromString(addr); err != nil {
+				errs = append(errs, fmt.Errorf("invalid bootstrap peer %s: %w", addr, err))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid network.type %s, must be %s or %s", cfg.Network.Type, NetworkMessenger, NetworkP2P))
+	}
+
+	errs = append(errs, cfg.TLS.validate()...)
+
+	if !store.IsRegistryNetwork(cfg.Registry.Network) {
+		errs = append(errs, fmt.Errorf("invalid registry.network %s, must be mainnet, prater or holesky", cfg.Registry.Network))
+	}
+
+	var err error
+	if params.HeartbeatInterval, err = parseTimeout("timeouts.heartbeat_interval", cfg.Timeouts.HeartbeatInterval); err != nil {
+		errs = append(errs, err)
+	}
+	if params.Registry.Timeout, err = parseTimeout("timeouts.registry", cfg.Timeouts.Registry); err != nil {
+		errs = append(errs, err)
+	}
+	if params.ShutdownGracePeriod, err = parseTimeout("timeouts.shutdown_grace_period", cfg.Timeouts.ShutdownGracePeriod); err != nil {
+		errs = append(errs, err)
+	}
+
+	if params.OperatorPrivateKey, err = cfg.OperatorKey.load(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.PolicyFile != "" {
+		if params.Policy, err = policy.Load(cfg.PolicyFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return params, errs
+}
+
+func (tls *TLSConfig) validate() []error {
+	errs := make([]error, 0)
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls.cert_file and tls.key_file must be set together"))
+	}
+	if tls.ClientCAFile != "" && tls.CertFile == "" {
+		errs = append(errs, fmt.Errorf("tls.client_ca_file requires tls.cert_file and tls.key_file"))
+	}
+	for _, file := range []string{tls.CertFile, tls.KeyFile, tls.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("invalid tls file: %w", err))
+		}
+	}
+	return errs
+}
+
+func (key *OperatorKeyConfig) load() (*rsa.PrivateKey, error) {
+	if key.PasswordPath == "" {
+		if key.Key == "" {
+			return nil, fmt.Errorf("operator_key.key or operator_key.path and operator_key.password_path is required")
+		}
+		decodedKey, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 encoded operator private key: %w", err)
+		}
+		operatorPrivateKey, err := types.PemToPrivateKey(decodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert pem block to rsa private key %w", err)
+		}
+		return operatorPrivateKey, nil
+	}
+
+	lockedPrivateKey, err := os.ReadFile(key.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operator private key file %w", err)
+	}
+	keyPassword, err := os.ReadFile(key.PasswordPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operator private key password file %w", err)
+	}
+	privateKey, err := utils.UnlockRSAJSON(lockedPrivateKey, string(keyPassword))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock operator private key %w", err)
+	}
+	return privateKey, nil
+}
+
+func validateURL(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("missing url")
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%s is not an http(s) url", addr)
+	}
+	return nil
+}
+
+func parseTimeout(name, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %s, must be positive", name, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadParams(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+
+	t.Run("overrides", func(t *testing.T) {
+		path := writeConfig(t, "node.yaml", `
+operator_id: 1
+http_addr: 0.0.0.0:8081
+broadcast_addr: http://localhost:8081
+data_dir: /data
+operator_key:
+  key: `+encodedKey+`
+timeouts:
+  heartbeat_interval: 5s
+`)
+		t.Setenv("NODE_ADDR", "0.0.0.0:8082")
+		t.Setenv("NODE_DATA_DIR", "/env-data")
+
+		params, err := loadParams("node", []string{"-config", path, "-data-dir", "/flag-data"})
+		require.NoError(t, err)
+		require.Equal(t, types.OperatorID(1), params.OperatorID)
+		require.Equal(t, "0.0.0.0:8082", params.HttpAddress)
+		require.Equal(t, "/flag-data", params.DataDir)
+		require.Equal(t, 5*time.Second, params.HeartbeatInterval)
+		require.Equal(t, NetworkMessenger, params.Network)
+		require.True(t, key.Equal(params.OperatorPrivateKey))
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		path := writeConfig(t, "node.toml", `
+operator_id = 2
+broadcast_addr = "http://localhost:8082"
+
+[operator_key]
+key = "`+encodedKey+`"
+
+[registry]
+network = "holesky"
+`)
+		params, err := loadParams("node", []string{"-config", path})
+		require.NoError(t, err)
+		require.Equal(t, types.OperatorID(2), params.OperatorID)
+		require.Equal(t, "holesky", params.Registry.Network)
+		require.Equal(t, DefaultDataDir, params.DataDir)
+	})
+
+	t.Run("every problem is reported", func(t *testing.T) {
+		path := writeConfig(t, "node.yaml", `
+http_addr: localhost
+network:
+  type: p2p
+registry:
+  network: sepolia
+timeouts:
+  registry: "-1s"
+`)
+		_, err := loadParams("node", []string{"-config", path})
+		require.Error(t, err)
+		problems := strings.Split(err.Error(), "\n")
+		require.Len(t, problems, 6, err.Error())
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		path := writeConfig(t, "node.yaml", "operator_idd: 1\n")
+		_, err := loadParams("node", []string{"-config", path})
+		require.ErrorContains(t, err, "operator_idd")
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keystore"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// runExportShareCommand handles `node export-share [flags]`, which writes the
+// operator's key share of a validator as an EIP-2335 keystore for
+// `reconstruct-key`. The node must be stopped, badger locks the data dir.
+func runExportShareCommand(args []string) int {
+	dataDir := os.Getenv("NODE_DATA_DIR")
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+	}
+
+	fs := flag.NewFlagSet("node export-share", flag.ContinueOnError)
+	fs.StringVar(&dataDir, "data-dir", dataDir, "badger data dir of the stopped node")
+	validatorPK := fs.String("validator-pk", "", "hex public key of the validator")
+	passwordFile := fs.String("password-file", "", "file with the password to encrypt the share keystore with")
+	outputDir := fs.String("output-dir", ".", "directory the share keystore is written to")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *validatorPK == "" || *passwordFile == "" {
+		fmt.Fprintln(os.Stderr, "usage: node export-share -validator-pk hex -password-file file [-data-dir dir] [-output-dir dir]")
+		return 2
+	}
+
+	filename, err := exportShare(dataDir, *validatorPK, *passwordFile, *outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export key share: %s\n", err.Error())
+		return 1
+	}
+	fmt.Printf("wrote key share of validator %s to file: %s\n", *validatorPK, filename)
+	return 0
+}
+
+func exportShare(dataDir, validatorPK, passwordFile, outputDir string) (string, error) {
+	vk, err := hex.DecodeString(strings.TrimPrefix(validatorPK, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid validator public key: %w", err)
+	}
+	data, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+
+	db, err := setupDB(dataDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open data dir, is the node still running: %w", err)
+	}
+	defer db.Close()
+
+	// only the key share is read, the operator's identity isn't needed
+	output, err := store.NewStorage(db, 0, nil).GetKeyGenOutput(types.ValidatorPK(vk))
+	if err != nil {
+		return "", fmt.Errorf("no key share of validator %x: %w", vk, err)
+	}
+
+	ks, err := keystore.NewEIP2335(output.Share.Serialize(), output.Share.GetPublicKey().Serialize(), password, fmt.Sprintf("dkg key share of validator %x", vk))
+	if err != nil {
+		return "", err
+	}
+	filename := filepath.Join(outputDir, fmt.Sprintf("share_%x.json", vk))
+	return filename, utils.WriteJSON(filename, ks)
+}
@@ -22,17 +22,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/RockX-SG/frost-dkg-demo/internal/keymanager"
 	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
 	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/p2p"
 	"github.com/RockX-SG/frost-dkg-demo/internal/ping"
 	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
 
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/dkg/frost"
@@ -40,6 +50,8 @@ import (
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/dgraph-io/badger/v3"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 )
 
 const serviceName = "node"
@@ -51,17 +63,37 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export-share" {
+		os.Exit(runExportShareCommand(os.Args[2:]))
+	}
 
 	log := logger.New(serviceName)
-	params := &AppParams{}
-	if err := params.loadFromEnv(); err != nil {
-		log.Errorf("Main: failed to load app params: %s", err.Error())
+	params, err := loadParams(os.Args[0], os.Args[1:])
+	if err != nil {
+		log.Errorf("Main: invalid config: %s", strings.ReplaceAll(err.Error(), "\n", "; "))
+		panic(err)
+	}
+	logger.AddFields(log, logrus.Fields{logger.OperatorIDField: params.OperatorID})
+	log.Debugf("Main: app env: %s messenger addr: %s", params.print(), params.MessengerAddress)
+
+	if _, err := tlsconfig.ClientConfigFromEnv(); err != nil {
+		log.Errorf("Main: invalid client tls config: %s", err.Error())
 		panic(err)
 	}
-	log.Debugf("Main: app env: %s messenger addr: %s", params.print(), messenger.MessengerAddrFromEnv())
+	store.ConfigureRegistry(params.Registry)
+
+	shutdownTracing, err := tracing.Init(context.Background(), serviceName)
+	if err != nil {
+		log.Errorf("Main: failed to set up tracing: %s", err.Error())
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
 
 	// set up db for storage
-	db, err := setupDB()
+	db, err := setupDB(params.DataDir)
 	if err != nil {
 		log.Errorf("Main: failed to setup DB: %s", err.Error())
 		panic(err)
@@ -70,13 +102,48 @@ func main() {
 
 	storage := store.NewStorage(db, params.OperatorID, params.OperatorPrivateKey)
 	signer := keymanager.NewKeyManager(types.PrimusTestnet)
-	network := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
+	h := node.New(log)
+	h.Policy = params.Policy
+	h.SlashingProtection = store.NewSlashingProtection(db)
+	h.SupersededShares = store.NewSupersededShares(db)
+	h.RetiredShares = store.NewRetiredShares(db)
+
+	var (
+		network         dkg.Network
+		messengerClient *messenger.Client
+		p2pNetwork      *p2p.Network
+	)
+	switch params.Network {
+	case NetworkP2P:
+		identity, err := p2p.LoadOrCreateIdentity(db)
+		if err != nil {
+			log.Errorf("Main: failed to load p2p identity: %s", err.Error())
+			panic(err)
+		}
+		p2pNetwork, err = p2p.New(&p2p.Config{
+			ListenAddrs: params.P2PListenAddrs,
+			Bootstrap:   params.P2PBootstrap,
+			Identity:    identity,
+		}, log)
+		if err != nil {
+			log.Errorf("Main: failed to start p2p network: %s", err.Error())
+			panic(err)
+		}
+		defer p2pNetwork.Close()
+		log.Infof("Main: p2p network listening on %v", p2pNetwork.Addrs())
+
+		h.Joiner = p2pNetwork
+		network = p2pNetwork
+	default:
+		messengerClient = messenger.NewMessengerClient(params.MessengerAddress)
+		network = messengerClient
+	}
 
 	config := &dkg.Config{
 		KeygenProtocol:      frost.New,
 		ReshareProtocol:     frost.NewResharing,
 		KeySign:             keysign.NewSignature,
-		Network:             network,
+		Network:             h.InstrumentNetwork(network),
 		Signer:              signer,
 		Storage:             storage,
 		SignatureDomainType: types.PrimusTestnet,
@@ -89,39 +156,130 @@ func main() {
 	}
 	dkgnode := dkg.NewNode(thisOperator, config)
 
-	// register dkg operator node with the messenger
-	if err := network.RegisterOperatorNode(strconv.Itoa(int(params.OperatorID)), os.Getenv("NODE_BROADCAST_ADDR")); err != nil {
-		log.Errorf("Main: %s", err.Error())
-		panic(err)
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	h := node.New(log)
+	if p2pNetwork != nil {
+		p2pNetwork.SetHandler(func(msg *types.SSVMessage) error {
+			return h.ProcessMessage(context.Background(), dkgnode, msg)
+		})
+	} else {
+		// keep the dkg operator node registered with the messenger in the background
+		// so that this node keeps serving even while the messenger is unreachable.
+		// Heartbeats stop on shutdown so that the messenger stops adding the node to new topics.
+		registration := node.NewRegistration(
+			messengerClient,
+			strconv.Itoa(int(params.OperatorID)),
+			params.BroadcastAddress,
+			params.HeartbeatInterval,
+			log,
+		)
+		go registration.Run(ctx)
+	}
 
 	// register api routes
 	r := gin.Default()
 	r.SetTrustedProxies(nil)
 
 	r.Use(logger.GinLogger(log))
+	r.Use(tracing.Middleware())
 
 	r.GET("/ping", ping.HandlePing)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// handle incoming message
 	r.POST("/consume", h.HandleConsume(dkgnode))
 
+	// sign keysign payloads with the key share for aggregation by the cli
+	r.POST("/keysign/partial", h.HandlePartialSignature(dkgnode, params.OperatorID))
+
+	// share of a validator
+	r.GET("/shares/:vk", h.HandleGetShare(dkgnode))
+
+	// changing the shares requires mTLS and an allowed initiator
+	shares := r.Group("/shares", h.RequireInitiator())
+	{
+		// delete the shares superseded by a resharing or refresh once the new shares are confirmed
+		shares.POST("/:vk/confirm", h.HandleConfirmShare(params.OperatorID))
+		// retire and delete the share of an operator that left the cluster
+		shares.POST("/:vk/retire", h.HandleRetireShare(params.OperatorID))
+		shares.DELETE("/:vk", h.HandleDeleteShare())
+	}
+
 	// get dkg results
 	r.GET("/dkg_results/:vk", h.HandleGetDKGResults(dkgnode))
 
+	// without the messenger the node keeps the outputs of its ceremonies
+	if p2pNetwork != nil {
+		r.GET("/data/:request_id", p2pNetwork.HandleGetData())
+	}
+
 	r.GET("/version", func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{
 			"version": version,
 		})
 	})
 
-	panic(r.Run(params.HttpAddress))
+	srv, err := tlsconfig.NewServer(params.HttpAddress, r, params.TLS)
+	if err != nil {
+		log.Errorf("Main: invalid server tls config: %s", err.Error())
+		panic(err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- tlsconfig.Serve(srv)
+	}()
+
+	select {
+	case err := <-serveErr:
+		panic(err)
+	case <-ctx.Done():
+	}
+	// the network and the db are closed by the deferred calls
+	shutdown(log, srv, h, params.ShutdownGracePeriod)
 }
 
-func setupDB() (*badger.DB, error) {
-	return badger.Open(badger.DefaultOptions("/frost-dkg-data"))
+// shutdown refuses new ceremonies and gives the running ones the grace period
+// to finish before the http server is stopped
+func shutdown(log *logrus.Logger, srv *http.Server, h *node.ApiHandler, gracePeriod time.Duration) {
+	log.Infof("Main: shutting down, waiting up to %s for running ceremonies", gracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	if err := h.Drain(ctx); err != nil {
+		log.Warnf("Main: shutting down before all ceremonies finished: %s", err.Error())
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warnf("Main: failed to shut down the http server: %s", err.Error())
+	}
+	log.Infof("Main: %s stopped", serviceName)
+}
+
+func setupDB(dataDir string) (*badger.DB, error) {
+	return badger.Open(badger.DefaultOptions(dataDir))
+}
+
+// runConfigCommand handles `node config validate [flags]`, which checks the
+// config the node would start with and prints every problem found
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: node config validate [-config file] [flags]")
+		return 2
+	}
+
+	params, err := loadParams("node config validate", args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "  - %s\n", line)
+		}
+		return 1
+	}
+	fmt.Printf("config is valid: %s\n", params.print())
+	return 0
 }
 
 func thisOperator(operatorID uint32, storage dkg.Storage) (*dkg.Operator, error) {
@@ -0,0 +1,272 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keymanager"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/transcript"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/dkg/keysign"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+)
+
+var (
+	file        string
+	mode        string
+	operatorIDs string
+	operatorKey string
+	dataDir     string
+)
+
+func init() {
+	flag.StringVar(&file, "file", "", "transcript file recorded by the messenger")
+	flag.StringVar(&mode, "mode", "print", "print: decode and print the transcript, replay: feed the transcript into in-process dkg nodes")
+	flag.StringVar(&operatorIDs, "operators", "", "comma separated IDs of the operators to replay, e.g. 1,2,3,4")
+	flag.StringVar(&operatorKey, "operator-key", "", "base64 encoded pem private key of the replayed operator. Replaying a single operator with its real key; hardcoded test keys are used otherwise")
+	flag.StringVar(&dataDir, "data-dir", "", "badger data dir of the replayed nodes, with a sub dir per operator. Needed to replay resharing or keysign, in memory otherwise")
+
+	types.InitBLS()
+}
+
+func checkErr(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func main() {
+	flag.Parse()
+	if file == "" {
+		checkErr(fmt.Errorf("missing transcript file"))
+	}
+
+	entries, err := transcript.Read(file)
+	checkErr(err)
+
+	switch mode {
+	case "print":
+		checkErr(printTranscript(entries))
+	case "replay":
+		checkErr(replay(entries))
+	default:
+		checkErr(fmt.Errorf("unknown mode %s", mode))
+	}
+}
+
+type decodedEntry struct {
+	*transcript.Entry
+	Message     *dkg.SignedMessage `json:"message,omitempty"`
+	ProtocolMsg *frost.ProtocolMsg `json:"protocol_msg,omitempty"`
+}
+
+func printTranscript(entries []*transcript.Entry) error {
+	for _, entry := range entries {
+		signedMsg, protocolMsg, _ := transcript.Decode(entry.Data)
+		out, err := json.MarshalIndent(&decodedEntry{
+			Entry:       entry,
+			Message:     signedMsg,
+			ProtocolMsg: protocolMsg,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	}
+	return nil
+}
+
+// replayNetwork queues the broadcasts of the replayed nodes, which are delivered
+// once the node is done processing the current message
+type replayNetwork struct {
+	operatorID types.OperatorID
+	pending    *[]*types.SSVMessage
+}
+
+func (n *replayNetwork) StreamDKGBlame(blame *dkg.BlameOutput) error {
+	out, _ := json.MarshalIndent(blame, "", "  ")
+	fmt.Printf("operator %d streamed blame:\n%s\n", n.operatorID, string(out))
+	return nil
+}
+
+func (n *replayNetwork) StreamDKGOutput(output map[types.OperatorID]*dkg.SignedOutput) error {
+	out, _ := json.MarshalIndent(output, "", "  ")
+	fmt.Printf("operator %d streamed output:\n%s\n", n.operatorID, string(out))
+	return nil
+}
+
+func (n *replayNetwork) BroadcastDKGMessage(msg *dkg.SignedMessage) error {
+	data, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+	*n.pending = append(*n.pending, &types.SSVMessage{
+		MsgType: types.DKGMsgType,
+		Data:    data,
+	})
+	return nil
+}
+
+// replay feeds the recorded messages into fresh nodes of the replayed operators.
+// Messages the replayed operators published themselves are skipped as the nodes
+// produce them again, all other messages are fed in the recorded order.
+func replay(entries []*transcript.Entry) error {
+	ids, err := parseOperatorIDs(operatorIDs)
+	if err != nil {
+		return err
+	}
+
+	pending := make([]*types.SSVMessage, 0)
+	nodes := make(map[types.OperatorID]*dkg.Node)
+	for _, id := range ids {
+		key, err := replayKey(id, len(ids))
+		if err != nil {
+			return err
+		}
+		db, err := openDB(id)
+		if err != nil {
+			return fmt.Errorf("failed to open db for operator %d: %w", id, err)
+		}
+		defer db.Close()
+
+		storage := store.NewStorage(db, id, key)
+		exist, operator, err := storage.GetDKGOperator(id)
+		if err != nil {
+			return fmt.Errorf("failed to get operator %d: %w", id, err)
+		}
+		if !exist {
+			return fmt.Errorf("operator with ID %d doesn't exist", id)
+		}
+
+		nodes[id] = dkg.NewNode(operator, &dkg.Config{
+			KeygenProtocol:      frost.New,
+			ReshareProtocol:     frost.NewResharing,
+			KeySign:             keysign.NewSignature,
+			Network:             &replayNetwork{operatorID: id, pending: &pending},
+			Signer:              keymanager.NewKeyManager(types.PrimusTestnet),
+			Storage:             storage,
+			SignatureDomainType: types.PrimusTestnet,
+		})
+	}
+
+	deliver := func(signer types.OperatorID, msg *types.SSVMessage, includeSigner bool) {
+		for _, id := range ids {
+			if id == signer && !includeSigner {
+				continue
+			}
+			if err := nodes[id].ProcessMessage(msg); err != nil {
+				fmt.Printf("operator %d failed to process message from %d: %s\n", id, signer, err.Error())
+			}
+		}
+	}
+
+	for i, entry := range entries {
+		if entry.Error != "" {
+			fmt.Printf("skipping entry %d: %s\n", i, entry.Error)
+			continue
+		}
+		// relayed messages of replayed operators are produced by the nodes again
+		if _, replayed := nodes[entry.Signer]; replayed && entry.Relayed {
+			continue
+		}
+
+		msg := &types.SSVMessage{}
+		if err := msg.Decode(entry.Data); err != nil {
+			return fmt.Errorf("failed to decode entry %d: %w", i, err)
+		}
+		fmt.Printf("feeding entry %d from %d msgType %d round %d\n", i, entry.Signer, entry.MsgType, entry.Round)
+
+		// init messages aren't relayed and go to every operator including the signer
+		deliver(entry.Signer, msg, !entry.Relayed)
+
+		for len(pending) > 0 {
+			next := pending[0]
+			pending = pending[1:]
+
+			signedMsg := &dkg.SignedMessage{}
+			if err := signedMsg.Decode(next.Data); err != nil {
+				return fmt.Errorf("failed to decode broadcast message: %w", err)
+			}
+			deliver(signedMsg.Signer, next, false)
+		}
+	}
+	return nil
+}
+
+func parseOperatorIDs(s string) ([]types.OperatorID, error) {
+	ids := make([]types.OperatorID, 0)
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid operator ID %s: %w", part, err)
+		}
+		ids = append(ids, types.OperatorID(id))
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no operators to replay")
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func replayKey(id types.OperatorID, numOperators int) (*rsa.PrivateKey, error) {
+	if operatorKey != "" {
+		if numOperators != 1 {
+			return nil, fmt.Errorf("operator key can only be used when replaying a single operator")
+		}
+		decodedKey, err := base64.StdEncoding.DecodeString(operatorKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 encoded operator private key: %w", err)
+		}
+		return types.PemToPrivateKey(decodedKey)
+	}
+
+	operator, ok := store.DKGOperators[id]
+	if !ok {
+		return nil, fmt.Errorf("no test key for operator %d, use -operator-key", id)
+	}
+	return operator.EncryptionKey, nil
+}
+
+func openDB(id types.OperatorID) (*badger.DB, error) {
+	if dataDir == "" {
+		return badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	}
+	return badger.Open(badger.DefaultOptions(fmt.Sprintf("%s/%d", dataDir, id)).WithLogger(nil))
+}
@@ -25,7 +25,9 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
 	"github.com/bloxapp/ssv-spec/dkg"
@@ -35,6 +37,27 @@ import (
 type DKGResult struct {
 	Output map[types.OperatorID]SignedOutput `json:"output,omitempty"`
 	Blame  *dkg.BlameOutput                  `json:"blame,omitempty"`
+	// Rejections holds the reason of every operator that refused a message
+	// of the ceremony relayed by the messenger
+	Rejections map[string]string `json:"rejections,omitempty"`
+}
+
+// Rejected returns an error listing the operators that refused the ceremony,
+// which can't finish without them
+func (r *DKGResult) Rejected() error {
+	if len(r.Rejections) == 0 {
+		return nil
+	}
+	operators := make([]string, 0, len(r.Rejections))
+	for operator := range r.Rejections {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+	reasons := make([]string, 0, len(operators))
+	for _, operator := range operators {
+		reasons = append(reasons, fmt.Sprintf("operator %s: %s", operator, r.Rejections[operator]))
+	}
+	return fmt.Errorf("operators refused the ceremony: %s", strings.Join(reasons, "; "))
 }
 
 type Output struct {
@@ -79,15 +102,15 @@ func (r *DKGResult) GetValidatorPK() (types.ValidatorPK, error) {
 
 func (r *DKGResult) GetSignatureFromKeySign() (string, error) {
 	var sig []byte
-	for _, output := range r.Output {
+	for operatorID, output := range r.Output {
 		sigBytes, err := hex.DecodeString(output.KeySignData.Signature)
 		if err != nil {
-			return "", fmt.Errorf("GetValidatorPK: failed to decode validator PK from its hex value: %w", err)
+			return "", fmt.Errorf("GetSignatureFromKeySign: failed to decode signature of operator %d from its hex value: %w", operatorID, err)
 		}
 
 		if sig != nil {
 			if !bytes.Equal(sig, sigBytes) {
-				return "", fmt.Errorf("GetValidatorPK: invalid dkg result, vk from all operators are not equal")
+				return "", fmt.Errorf("GetSignatureFromKeySign: invalid dkg result, signatures from all operators are not equal")
 			}
 		}
 
@@ -98,7 +121,9 @@ func (r *DKGResult) GetSignatureFromKeySign() (string, error) {
 
 func formatResults(data *messenger.DataStore) *DKGResult {
 	if data.BlameOutput != nil {
-		return formatBlameResults(data.BlameOutput)
+		result := formatBlameResults(data.BlameOutput)
+		result.Rejections = data.Rejections
+		return result
 	}
 	output := make(map[types.OperatorID]SignedOutput)
 
@@ -131,7 +156,7 @@ func formatResults(data *messenger.DataStore) *DKGResult {
 		}
 	}
 
-	return &DKGResult{Output: output}
+	return &DKGResult{Output: output, Rejections: data.Rejections}
 }
 
 func formatBlameResults(blameOutput *dkg.BlameOutput) *DKGResult {
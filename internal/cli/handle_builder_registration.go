@@ -0,0 +1,144 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/cli/v2"
+)
+
+const DefaultGasLimit = 30000000
+
+// RegistrationRequest is a validator to register with the builders, as an
+// entry of the batch file. The fee recipient and gas limit of the command are
+// used if they aren't set.
+type RegistrationRequest struct {
+	ValidatorPK  string `json:"validator_pk"`
+	FeeRecipient string `json:"fee_recipient,omitempty"`
+	GasLimit     uint64 `json:"gas_limit,omitempty"`
+}
+
+func (h *CliHandler) HandleBuilderRegistration(c *cli.Context) error {
+	requests, err := parseRegistrationRequests(c)
+	if err != nil {
+		return fmt.Errorf("HandleBuilderRegistration: %w", err)
+	}
+
+	// all registrations share the timestamp, relays only accept newer ones
+	timestamp := time.Unix(time.Now().Unix(), 0)
+	if c.IsSet("timestamp") {
+		timestamp = time.Unix(c.Int64("timestamp"), 0)
+	}
+
+	registrations := make([]*apiv1.SignedValidatorRegistration, 0, len(requests))
+	errs := make([]error, 0)
+	for _, request := range requests {
+		registration, err := h.signRegistration(c, request, timestamp)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("HandleBuilderRegistration: validator %s: %w", request.ValidatorPK, err))
+			continue
+		}
+		registrations = append(registrations, registration)
+	}
+
+	if len(registrations) > 0 {
+		filename := filepath.Join(c.String("output-dir"), fmt.Sprintf("validator_registrations_%d.json", time.Now().Unix()))
+		fmt.Printf("writing %d signed validator registrations to file: %s\n", len(registrations), filename)
+		if err := utils.WriteJSON(filename, registrations); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func parseRegistrationRequests(c *cli.Context) ([]*RegistrationRequest, error) {
+	requests := make([]*RegistrationRequest, 0)
+	for _, vk := range c.StringSlice("validator-pk") {
+		requests = append(requests, &RegistrationRequest{ValidatorPK: vk})
+	}
+
+	if c.String("batch-file") != "" {
+		data, err := os.ReadFile(c.String("batch-file"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch file: %w", err)
+		}
+		batch := make([]*RegistrationRequest, 0)
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("failed to parse batch file: %w", err)
+		}
+		requests = append(requests, batch...)
+	}
+
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("--validator-pk or --batch-file is required")
+	}
+	for _, request := range requests {
+		if request.FeeRecipient == "" {
+			request.FeeRecipient = c.String("fee-recipient")
+		}
+		if request.GasLimit == 0 {
+			request.GasLimit = c.Uint64("gas-limit")
+		}
+		if !common.IsHexAddress(request.FeeRecipient) {
+			return nil, fmt.Errorf("invalid fee recipient %q of validator %s", request.FeeRecipient, request.ValidatorPK)
+		}
+	}
+	return requests, nil
+}
+
+func (h *CliHandler) signRegistration(c *cli.Context, request *RegistrationRequest, timestamp time.Time) (*apiv1.SignedValidatorRegistration, error) {
+	vk, err := parseValidatorPK(request.ValidatorPK)
+	if err != nil {
+		return nil, err
+	}
+
+	registration := &apiv1.ValidatorRegistration{
+		FeeRecipient: bellatrix.ExecutionAddress(common.HexToAddress(request.FeeRecipient)),
+		GasLimit:     request.GasLimit,
+		Timestamp:    timestamp,
+	}
+	copy(registration.Pubkey[:], vk)
+
+	sig, err := h.SignPayload(c, vk, &signing.Payload{
+		Type:                  signing.TypeValidatorRegistration,
+		Network:               c.String("network"),
+		ValidatorRegistration: registration,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign validator registration: %w", err)
+	}
+
+	signed := &apiv1.SignedValidatorRegistration{Message: registration}
+	copy(signed.Signature[:], sig)
+	return signed, nil
+}
@@ -35,6 +35,10 @@ func (h *CliHandler) HandleGetData(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("HandleGetData: failed to get dkg result for requestID %s: %w", requestID, err)
 	}
+	return writeResults(requestID, results)
+}
+
+func writeResults(requestID string, results *DKGResult) error {
 	filepath := fmt.Sprintf("dkg_results_%s_%d.json", requestID, time.Now().Unix())
 	fmt.Printf("writing results to file: %s\n", filepath)
 	return utils.WriteJSON(filepath, results)
@@ -24,22 +24,16 @@ package cli
 import (
 	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
 	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/herumi/bls-eth-go-binary/bls"
 	"github.com/urfave/cli/v2"
-
-	"github.com/wealdtech/go-merkletree/keccak256"
 )
 
 func (h *CliHandler) HandleGetKeyShares(c *cli.Context) error {
-	// the following two lines are temporary workaround
-	network := c.String("network")
-	os.Setenv("OPERATOR_REGISTRY_NETWORK", network)
-
 	keygenRequestID := c.String("request-id")
 
 	keygenOutput, err := h.DKGResultByRequestID(keygenRequestID)
@@ -52,68 +46,37 @@ func (h *CliHandler) HandleGetKeyShares(c *cli.Context) error {
 		return fmt.Errorf("HandleGetKeyShares: failed to get ValidatorPK from keygen results: %w", err)
 	}
 
-	ownerAddress := common.HexToAddress(c.String("owner-address")).Hex()
-	ownerNonce := c.Int("owner-nonce")
-
-	signingRoot := keccak256.New().Hash([]byte(fmt.Sprintf("%s:%d", ownerAddress, ownerNonce)))
-
-	signatureRequestID, err := h.GenerateSignature(c, vk, signingRoot)
-	if err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to send signingRoot for signature: %w", err)
+	if _, err := h.writeKeyShares(c, vk, keygenOutput); err != nil {
+		return fmt.Errorf("HandleGetKeyShares: %w", err)
 	}
+	return nil
+}
 
-	var signatureResult *DKGResult
-
-	try := 0
-	sleepTime := 2
-
-	for {
-		if try == 4 {
-			break
-		}
-
-		signatureResult, err = h.DKGResultByRequestID(hex.EncodeToString(signatureRequestID[:]))
-		if err != nil {
-			time.Sleep(time.Duration(sleepTime) * time.Second)
-			try++
-			continue
-		} else {
-			break
-		}
-	}
+// writeKeyShares signs the owner prefix with the shares of the result and
+// writes the keyshares file for registering the validator on SSV
+func (h *CliHandler) writeKeyShares(c *cli.Context, vk types.ValidatorPK, result *DKGResult) (*KeyShares, error) {
+	ownerAddress := common.HexToAddress(c.String("owner-address")).Hex()
+	ownerNonce := c.Int("owner-nonce")
 
-	if signatureResult == nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to sign owner prefix: %w", err)
+	payload := &signing.Payload{
+		Type: signing.TypeSSVOwnerNonce,
+		OwnerNonce: &signing.OwnerNonce{
+			Owner: ownerAddress,
+			Nonce: uint64(ownerNonce),
+		},
 	}
-
-	ownerSig, err := signatureResult.GetSignatureFromKeySign()
+	sig, err := h.SignPayload(c, vk, payload)
 	if err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to parse owner prefix from signature result: %w", err)
-	}
-
-	var (
-		pk  bls.PublicKey
-		sig bls.Sign
-	)
-
-	if err := pk.Deserialize(vk); err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to deserialize ValidatorPK: %w", err)
-	}
-
-	if err := sig.DeserializeHexStr(ownerSig); err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to deserialize signature: %w", err)
-	}
-
-	if !sig.VerifyByte(&pk, signingRoot) {
-		return fmt.Errorf("HandleGetKeyShares: failed to verify signature")
+		return nil, fmt.Errorf("failed to sign owner prefix: %w", err)
 	}
+	ownerSig := hex.EncodeToString(sig)
 
 	keyshares := &KeyShares{}
-	if err := keyshares.GenerateKeyshareV4(keygenOutput, ownerSig, ownerAddress, ownerNonce); err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to parse keyshare from dkg results: %w", err)
+	if err := keyshares.GenerateKeyshareV4(result, c.String("network"), ownerSig, ownerAddress, ownerNonce); err != nil {
+		return nil, fmt.Errorf("failed to parse keyshare from dkg results: %w", err)
 	}
 
 	filename := fmt.Sprintf("keyshares-%d.json", time.Now().Unix())
 	fmt.Printf("writing keyshares to file: %s\n", filename)
-	return utils.WriteJSON(filename, keyshares)
+	return keyshares, utils.WriteJSON(filename, keyshares)
 }
@@ -22,18 +22,21 @@
 package cli
 
 import (
-	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/bloxapp/ssv-spec/types/testingutils"
 	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (h *CliHandler) HandleKeygen(c *cli.Context) error {
@@ -42,11 +45,19 @@ func (h *CliHandler) HandleKeygen(c *cli.Context) error {
 		return fmt.Errorf("HandleKeygen: failed to parse keygen request: %w", err)
 	}
 
+	localMessenger, err := h.startLocalMessengerFromFlags(c, keygenRequest.Operators)
+	if err != nil {
+		return fmt.Errorf("HandleKeygen: failed to start local messenger: %w", err)
+	}
+	if localMessenger != nil {
+		defer localMessenger.Close()
+	}
+
 	requestID := getRandRequestID()
 	requestIDInHex := hex.EncodeToString(requestID[:])
 
-	messengerClient := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
-	if err := messengerClient.CreateTopic(requestIDInHex, keygenRequest.allOperators()); err != nil {
+	messengerClient, err := h.openCeremony(c, requestIDInHex, keygenRequest.allOperators())
+	if err != nil {
 		return fmt.Errorf("HandleKeygen: failed to create a new topic on messenger service: %w", err)
 	}
 
@@ -54,30 +65,72 @@ func (h *CliHandler) HandleKeygen(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("HandleKeygen: failed to generate init message for keygen: %w", err)
 	}
+	h.recordInitMsg(messengerClient, requestIDInHex, initMsgBytes)
 
 	for operatorID, nodeAddr := range keygenRequest.Operators {
-		if err := h.sendInitMsg(operatorID, nodeAddr, initMsgBytes); err != nil {
+		if err := h.sendInitMsg(c.Context, operatorID, nodeAddr, initMsgBytes); err != nil {
 			return fmt.Errorf("HandleKeygen: failed to send init message to operatorID %d: %w", operatorID, err)
 		}
 	}
 
 	fmt.Printf("keygen init request sent with ID: %s\n", requestIDInHex)
-	return nil
+	if localMessenger == nil {
+		return nil
+	}
+
+	// the local messenger goes away with the cli, so the results are collected now
+	results, err := localMessenger.waitForResult(requestIDInHex, c.Duration("local-messenger-timeout"))
+	if err != nil {
+		return fmt.Errorf("HandleKeygen: %w", err)
+	}
+	if err := writeResults(requestIDInHex, results); err != nil {
+		return err
+	}
+	return results.Rejected()
 }
 
-func (h *CliHandler) sendInitMsg(operatorID types.OperatorID, addr string, data []byte) error {
-	url := fmt.Sprintf("%s/consume", addr)
-	resp, err := h.client.Post(url, "application/json", bytes.NewBuffer(data))
+func (h *CliHandler) sendInitMsg(ctx context.Context, operatorID types.OperatorID, addr string, data []byte) error {
+	resp, err := h.post(ctx, fmt.Sprintf("%s/consume", addr), data)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("request to operator %d to consume init message failed with status %s", operatorID, resp.Status)
+		return fmt.Errorf("request to operator %d to consume init message failed with status %s", operatorID, consumeError(resp))
 	}
 	return nil
 }
 
+// openCeremony creates the topic of the ceremony on the messenger and ties the
+// trace of the command to the request ID. In p2p mode the nodes join the
+// ceremony when they get the init message and no messenger is involved, so it
+// returns a nil client.
+func (h *CliHandler) openCeremony(c *cli.Context, requestID string, operators []types.OperatorID) (*messenger.Client, error) {
+	trace.SpanFromContext(c.Context).SetAttributes(tracing.RequestID(requestID))
+	tracing.SetCeremonyContext(requestID, c.Context)
+	logger.ForRequest(h.logger, requestID).Infof("opening %s ceremony with operators %v", c.Command.Name, operators)
+
+	if c.Bool("p2p") {
+		return nil, nil
+	}
+	messengerClient := messenger.NewMessengerClient(h.messengerAddr)
+	if err := messengerClient.CreateTopicWithWebhook(requestID, operators, webhookFromFlags(c)); err != nil {
+		return nil, err
+	}
+	return messengerClient, nil
+}
+
+// recordInitMsg adds the init message to the ceremony transcript. Init messages
+// don't go through the messenger, so a replay would miss them otherwise.
+func (h *CliHandler) recordInitMsg(messengerClient *messenger.Client, requestID string, data []byte) {
+	if messengerClient == nil {
+		return
+	}
+	if err := messengerClient.Record(requestID, data); err != nil {
+		logger.ForRequest(h.logger, requestID).Warnf("failed to record init message for request %s: %v", requestID, err)
+	}
+}
+
 type KeygenRequest struct {
 	Operators            map[types.OperatorID]string `json:"operators"`
 	Threshold            int                         `json:"threshold"`
@@ -22,24 +22,34 @@
 package cli
 
 import (
-	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/herumi/bls-eth-go-binary/bls"
 	"github.com/urfave/cli/v2"
 )
 
-func (h *CliHandler) GenerateSignature(c *cli.Context, vk types.ValidatorPK, signingRoot []byte) (dkg.RequestID, error) {
+const (
+	keySignResultRetries  = 4
+	keySignResultInterval = 2 * time.Second
+)
+
+// GenerateSignature asks the operators to sign the payload with the validator
+// key. The nodes recompute the signing root from the payload, so only payloads
+// of a known type can be signed.
+func (h *CliHandler) GenerateSignature(c *cli.Context, vk types.ValidatorPK, payload *signing.Payload) (dkg.RequestID, error) {
 	requestID := getRandRequestID()
 
-	keySign := dkg.KeySign{
-		ValidatorPK: vk,
-		SigningRoot: signingRoot,
+	keySign, err := signing.NewKeySign(vk, payload)
+	if err != nil {
+		return [24]byte{}, fmt.Errorf("HandleKeySign: invalid %s payload: %w", payload.Type, err)
 	}
 	keySignBytes, _ := keySign.Encode()
 
@@ -58,13 +68,14 @@ func (h *CliHandler) GenerateSignature(c *cli.Context, vk types.ValidatorPK, sig
 		ol = append(ol, operatorID)
 	}
 
-	messengerClient := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
-	if err := messengerClient.CreateTopic(hex.EncodeToString(requestID[:]), ol); err != nil {
+	messengerClient, err := h.openCeremony(c, hex.EncodeToString(requestID[:]), ol)
+	if err != nil {
 		return [24]byte{}, fmt.Errorf("HandleKeygen: failed to create a new topic on messenger service: %w", err)
 	}
+	h.recordInitMsg(messengerClient, hex.EncodeToString(requestID[:]), initBytes)
 
 	for operatorID, addr := range operators {
-		if err := h.sendKeySignMsg(operatorID, addr, initBytes); err != nil {
+		if err := h.sendKeySignMsg(c.Context, operatorID, addr, initBytes); err != nil {
 			return [24]byte{}, fmt.Errorf("HandleKeySign: failed to send init message to operatorID %d: %w", operatorID, err)
 		}
 	}
@@ -72,15 +83,82 @@ func (h *CliHandler) GenerateSignature(c *cli.Context, vk types.ValidatorPK, sig
 	return requestID, nil
 }
 
-func (h *CliHandler) sendKeySignMsg(operatorID types.OperatorID, addr string, data []byte) error {
-	url := fmt.Sprintf("%s/consume", addr)
-	resp, err := h.client.Post(url, "application/json", bytes.NewBuffer(data))
+// SignPayload runs a keysign ceremony for the payload, or aggregates the partial
+// signatures of the operators with --partial-signatures, and returns the
+// signature of the validator key once it is verified against the signing root
+func (h *CliHandler) SignPayload(c *cli.Context, vk types.ValidatorPK, payload *signing.Payload) ([]byte, error) {
+	if c.Bool("partial-signatures") {
+		return h.signWithPartials(c, vk, payload)
+	}
+
+	signingRoot, err := payload.SigningRoot(vk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", payload.Type, err)
+	}
+
+	requestID, err := h.GenerateSignature(c, vk, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send signing root for signature: %w", err)
+	}
+
+	result, err := h.waitForKeySign(hex.EncodeToString(requestID[:]))
+	if err != nil {
+		return nil, err
+	}
+	if result.Blame != nil {
+		return nil, fmt.Errorf("keysign ceremony %x failed, get-dkg-results shows the blame", requestID)
+	}
+	sigHex, err := result.GetSignatureFromKeySign()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature from keysign result: %w", err)
+	}
+
+	var (
+		pk  bls.PublicKey
+		sig bls.Sign
+	)
+	if err := pk.Deserialize(vk); err != nil {
+		return nil, fmt.Errorf("failed to deserialize ValidatorPK: %w", err)
+	}
+	if err := sig.DeserializeHexStr(sigHex); err != nil {
+		return nil, fmt.Errorf("failed to deserialize signature: %w", err)
+	}
+	if !sig.VerifyByte(&pk, signingRoot) {
+		return nil, fmt.Errorf("failed to verify signature")
+	}
+	return sig.Serialize(), nil
+}
+
+// waitForKeySign polls the results until the keysign ceremony has finished
+func (h *CliHandler) waitForKeySign(requestID string) (*DKGResult, error) {
+	var (
+		result *DKGResult
+		err    error
+	)
+	for try := 0; try < keySignResultRetries; try++ {
+		result, err = h.DKGResultByRequestID(requestID)
+		if err == nil && len(result.Output) == 0 && result.Blame == nil {
+			// the ceremony can't finish once an operator refused it
+			if err = result.Rejected(); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			return result, nil
+		}
+		time.Sleep(keySignResultInterval)
+	}
+	return nil, fmt.Errorf("failed to get result of keysign ceremony %s: %w", requestID, err)
+}
+
+func (h *CliHandler) sendKeySignMsg(ctx context.Context, operatorID types.OperatorID, addr string, data []byte) error {
+	resp, err := h.post(ctx, fmt.Sprintf("%s/consume", addr), data)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("request to operator %d to consume init message failed with status %s", operatorID, resp.Status)
+		return fmt.Errorf("request to operator %d to consume init message failed with status %s", operatorID, consumeError(resp))
 	}
 	return nil
 }
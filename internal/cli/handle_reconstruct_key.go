@@ -0,0 +1,225 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keystore"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/urfave/cli/v2"
+)
+
+const reconstructKeyWarning = `WARNING: the reconstructed validator key signs on its own, without the operators.
+Running it in a validator client while the SSV operators still run the validator
+gets the validator slashed. Only import it once the validator is removed from
+SSV and the operators have stopped it, and keep the keystore and its password
+offline until then.`
+
+// HandleReconstructKey interpolates the validator key from a threshold of the
+// key shares exported by the operators. It doesn't contact the operators or
+// the messenger.
+func (h *CliHandler) HandleReconstructKey(c *cli.Context) error {
+	fmt.Fprintln(os.Stderr, reconstructKeyWarning)
+	if !c.Bool("accept-risks") {
+		return fmt.Errorf("HandleReconstructKey: --accept-risks is required to reconstruct the validator key")
+	}
+
+	result, err := readDKGResult(c.String("dkg-result"))
+	if err != nil {
+		return fmt.Errorf("HandleReconstructKey: %w", err)
+	}
+	vk, err := result.GetValidatorPK()
+	if err != nil {
+		return fmt.Errorf("HandleReconstructKey: %w", err)
+	}
+
+	password, err := readPassword(c.String("password-file"))
+	if err != nil {
+		return fmt.Errorf("HandleReconstructKey: %w", err)
+	}
+
+	shares, err := readShareKeystores(c.StringSlice("share"), c.StringSlice("share-password-file"))
+	if err != nil {
+		return fmt.Errorf("HandleReconstructKey: %w", err)
+	}
+	sharePKs := make(map[types.OperatorID]string)
+	for operatorID, output := range result.Output {
+		sharePKs[operatorID] = output.Data.SharePubKey
+	}
+
+	sk, err := reconstructKey(vk, shares, sharePKs)
+	if err != nil {
+		return fmt.Errorf("HandleReconstructKey: %w", err)
+	}
+
+	ks, err := keystore.NewEIP2335(sk.Serialize(), vk, password, "validator key reconstructed from dkg key shares")
+	if err != nil {
+		return fmt.Errorf("HandleReconstructKey: %w", err)
+	}
+	filename := filepath.Join(c.String("output-dir"), fmt.Sprintf("keystore_%x_%d.json", vk, time.Now().Unix()))
+	fmt.Printf("writing keystore of validator %x to file: %s\n", vk, filename)
+	return utils.WriteJSON(filename, ks)
+}
+
+func readDKGResult(path string) (*DKGResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dkg result: %w", err)
+	}
+	result := &DKGResult{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("failed to parse dkg result: %w", err)
+	}
+	if result.Blame != nil || len(result.Output) == 0 {
+		return nil, fmt.Errorf("dkg result %s has no keygen output", path)
+	}
+	return result, nil
+}
+
+func readPassword(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// parseOperatorPaths parses operatorID=path pairs
+func parseOperatorPaths(flag string, values []string) (map[types.OperatorID]string, error) {
+	paths := make(map[types.OperatorID]string)
+	for _, s := range values {
+		pair := strings.Split(strings.Trim(s, " "), "=")
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("%s %s is not in the form of operatorID=path", flag, s)
+		}
+		operatorID, err := strconv.ParseUint(pair[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid operator ID of %s %s: %w", flag, s, err)
+		}
+		if _, ok := paths[types.OperatorID(operatorID)]; ok {
+			return nil, fmt.Errorf("%s of operator %d is given twice", flag, operatorID)
+		}
+		paths[types.OperatorID(operatorID)] = pair[1]
+	}
+	return paths, nil
+}
+
+// readShareKeystores decrypts the share keystores given as operatorID=path,
+// each with the password file given for its operator. Every operator
+// encrypts its share with its own password.
+func readShareKeystores(shareFlags, passwordFlags []string) (map[types.OperatorID]*bls.SecretKey, error) {
+	keystores, err := parseOperatorPaths("share", shareFlags)
+	if err != nil {
+		return nil, err
+	}
+	passwordFiles, err := parseOperatorPaths("share-password-file", passwordFlags)
+	if err != nil {
+		return nil, err
+	}
+	for operatorID := range passwordFiles {
+		if _, ok := keystores[operatorID]; !ok {
+			return nil, fmt.Errorf("password file of operator %d is given without its share", operatorID)
+		}
+	}
+
+	shares := make(map[types.OperatorID]*bls.SecretKey)
+	for operatorID, path := range keystores {
+		passwordFile, ok := passwordFiles[operatorID]
+		if !ok {
+			return nil, fmt.Errorf("no password file for the share of operator %d", operatorID)
+		}
+		password, err := readPassword(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("share of operator %d: %w", operatorID, err)
+		}
+
+		ks, err := keystore.ReadEIP2335FromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := ks.Decrypt(password)
+		if err != nil {
+			return nil, fmt.Errorf("share of operator %d: %w", operatorID, err)
+		}
+		share := &bls.SecretKey{}
+		if err := share.Deserialize(secret); err != nil {
+			return nil, fmt.Errorf("invalid key share of operator %d: %w", operatorID, err)
+		}
+		shares[operatorID] = share
+	}
+	return shares, nil
+}
+
+// reconstructKey checks every share against the share public key of its
+// operator in the dkg result and interpolates the validator secret key with
+// Lagrange coefficients
+func reconstructKey(vk types.ValidatorPK, shares map[types.OperatorID]*bls.SecretKey, sharePKs map[types.OperatorID]string) (*bls.SecretKey, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("%d key shares given, at least the threshold of the cluster is needed", len(shares))
+	}
+
+	operators := make([]types.OperatorID, 0, len(shares))
+	for operatorID := range shares {
+		operators = append(operators, operatorID)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+
+	sks := make([]bls.SecretKey, 0, len(shares))
+	ids := make([]bls.ID, 0, len(shares))
+	for _, operatorID := range operators {
+		sharePK, ok := sharePKs[operatorID]
+		if !ok {
+			return nil, fmt.Errorf("operator %d isn't an operator of the dkg result", operatorID)
+		}
+		if shares[operatorID].GetPublicKey().SerializeToHexStr() != strings.TrimPrefix(sharePK, "0x") {
+			return nil, fmt.Errorf("key share of operator %d doesn't match its share public key %s", operatorID, sharePK)
+		}
+
+		var id bls.ID
+		if err := id.SetDecString(strconv.FormatUint(uint64(operatorID), 10)); err != nil {
+			return nil, err
+		}
+		sks = append(sks, *shares[operatorID])
+		ids = append(ids, id)
+	}
+
+	sk := &bls.SecretKey{}
+	if err := sk.Recover(sks, ids); err != nil {
+		return nil, fmt.Errorf("failed to interpolate validator key: %w", err)
+	}
+	if !bytes.Equal(sk.GetPublicKey().Serialize(), vk) {
+		return nil, fmt.Errorf("key shares of operators %v don't interpolate to validator key %s, fewer than the threshold were given", operators, hex.EncodeToString(vk))
+	}
+	return sk, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keystore"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconstructKey(t *testing.T) {
+	validatorPK, shares := testSharing(t, 3, 4)
+	vk := validatorPK.Serialize()
+	sharePKs := make(map[types.OperatorID]string)
+	for operatorID, share := range shares {
+		sharePKs[operatorID] = share.GetPublicKey().SerializeToHexStr()
+	}
+
+	sk, err := reconstructKey(vk, map[types.OperatorID]*bls.SecretKey{1: shares[1], 3: shares[3], 4: shares[4]}, sharePKs)
+	require.NoError(t, err)
+	require.Equal(t, vk, sk.GetPublicKey().Serialize())
+
+	// fewer than the threshold
+	_, err = reconstructKey(vk, map[types.OperatorID]*bls.SecretKey{1: shares[1], 3: shares[3]}, sharePKs)
+	require.ErrorContains(t, err, "fewer than the threshold")
+
+	// a share given as another operator's
+	_, err = reconstructKey(vk, map[types.OperatorID]*bls.SecretKey{1: shares[1], 2: shares[3], 4: shares[4]}, sharePKs)
+	require.ErrorContains(t, err, "operator 2 doesn't match")
+}
+
+func TestReadShareKeystores(t *testing.T) {
+	_, shares := testSharing(t, 2, 3)
+	dir := t.TempDir()
+
+	// every operator encrypts its share with its own password
+	for _, operatorID := range []types.OperatorID{1, 2} {
+		password := fmt.Sprintf("password-%d", operatorID)
+		ks, err := keystore.NewEIP2335(shares[operatorID].Serialize(), shares[operatorID].GetPublicKey().Serialize(), password, "")
+		require.NoError(t, err)
+		require.NoError(t, utils.WriteJSON(filepath.Join(dir, fmt.Sprintf("share_%d.json", operatorID)), ks))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("password_%d.txt", operatorID)), []byte(password+"\n"), 0600))
+	}
+	share := func(operatorID int) string {
+		return fmt.Sprintf("%d=%s", operatorID, filepath.Join(dir, fmt.Sprintf("share_%d.json", operatorID)))
+	}
+	password := func(operatorID, file int) string {
+		return fmt.Sprintf("%d=%s", operatorID, filepath.Join(dir, fmt.Sprintf("password_%d.txt", file)))
+	}
+
+	decrypted, err := readShareKeystores([]string{share(1), share(2)}, []string{password(1, 1), password(2, 2)})
+	require.NoError(t, err)
+	require.True(t, decrypted[1].IsEqual(shares[1]))
+	require.True(t, decrypted[2].IsEqual(shares[2]))
+
+	// the password of another operator's share
+	_, err = readShareKeystores([]string{share(1), share(2)}, []string{password(1, 1), password(2, 1)})
+	require.ErrorContains(t, err, "share of operator 2")
+
+	_, err = readShareKeystores([]string{share(1), share(2)}, []string{password(1, 1)})
+	require.ErrorContains(t, err, "no password file for the share of operator 2")
+}
@@ -0,0 +1,155 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// HandleRefresh reshares the validator key to the operators that hold it, so
+// every share changes while the operators and the validator key stay the same.
+// The nodes delete the superseded shares once the new shares are confirmed.
+func (h *CliHandler) HandleRefresh(c *cli.Context) error {
+	operators, err := parseOperatorList(c)
+	if err != nil {
+		return fmt.Errorf("HandleRefresh: failed to parse operator list from command: %w", err)
+	}
+	vk, err := parseValidatorPK(c.String("validator-pk"))
+	if err != nil {
+		return fmt.Errorf("HandleRefresh: %w", err)
+	}
+	request := &ResharingRequest{
+		Operators:    operators,
+		OperatorsOld: operators,
+		Threshold:    c.Int("threshold"),
+		ValidatorPK:  hex.EncodeToString(vk),
+	}
+
+	if err := h.preflightResharing(c.Context, request); err != nil {
+		return fmt.Errorf("HandleRefresh: preflight failed: %w", err)
+	}
+
+	requestID := getRandRequestID()
+	requestIDInHex := hex.EncodeToString(requestID[:])
+
+	// every operator is in the old and the new set, it gets the message once
+	messengerClient, err := h.openCeremony(c, requestIDInHex, request.newOperators())
+	if err != nil {
+		return fmt.Errorf("HandleRefresh: failed to create a new topic on messenger service: %w", err)
+	}
+	initMsgBytes, err := request.initMsgForResharing(requestID)
+	if err != nil {
+		return fmt.Errorf("HandleRefresh: failed to generate init message for resharing: %w", err)
+	}
+	h.recordInitMsg(messengerClient, requestIDInHex, initMsgBytes)
+
+	for operatorID, addr := range operators {
+		if err := h.sendReshareMsg(c.Context, operatorID, addr, initMsgBytes); err != nil {
+			return fmt.Errorf("HandleRefresh: %w", err)
+		}
+	}
+	fmt.Printf("refresh init request sent with ID: %s\n", requestIDInHex)
+
+	result, err := h.waitForReshare(requestIDInHex, request.newOperators())
+	if err != nil {
+		return fmt.Errorf("HandleRefresh: %w, the nodes keep their superseded shares", err)
+	}
+	if err := writeResults(requestIDInHex, result); err != nil {
+		return fmt.Errorf("HandleRefresh: %w", err)
+	}
+	if result.Blame != nil {
+		return fmt.Errorf("HandleRefresh: refresh ceremony %s failed, get-dkg-results shows the blame, the nodes keep their superseded shares", requestIDInHex)
+	}
+	if err := checkReshareResult(vk, request.Threshold, result); err != nil {
+		return fmt.Errorf("HandleRefresh: %w, the nodes keep their superseded shares", err)
+	}
+
+	// signing the owner prefix with the refreshed shares also proves they work
+	if _, err := h.writeKeyShares(c, vk, result); err != nil {
+		return fmt.Errorf("HandleRefresh: %w, the nodes keep their superseded shares", err)
+	}
+
+	confirmation, err := h.signShareConfirmation(c, vk, requestIDInHex, result)
+	if err != nil {
+		return fmt.Errorf("HandleRefresh: %w, the nodes keep their superseded shares", err)
+	}
+	errs := make([]error, 0)
+	for operatorID, addr := range operators {
+		if err := h.confirmShare(c.Context, addr, vk, confirmation); err != nil {
+			errs = append(errs, fmt.Errorf("HandleRefresh: operator %d didn't delete its superseded shares: %w", operatorID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shareConfirmation is sent to the nodes to delete the shares a resharing or
+// refresh superseded
+type shareConfirmation struct {
+	Confirmation *signing.ShareConfirmation `json:"confirmation"`
+	Signature    string                     `json:"signature"`
+}
+
+// signShareConfirmation has the new shares sign the share public keys of the
+// result with the validator key, which proves to the nodes that the new
+// shares work
+func (h *CliHandler) signShareConfirmation(c *cli.Context, vk types.ValidatorPK, requestID string, result *DKGResult) (*shareConfirmation, error) {
+	confirmation := &signing.ShareConfirmation{
+		RequestID:    requestID,
+		SharePubKeys: make(map[types.OperatorID]string),
+	}
+	for operatorID, output := range result.Output {
+		confirmation.SharePubKeys[operatorID] = output.Data.SharePubKey
+	}
+	sig, err := h.SignPayload(c, vk, &signing.Payload{
+		Type:              signing.TypeShareConfirmation,
+		ShareConfirmation: confirmation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the confirmation of the new shares: %w", err)
+	}
+	return &shareConfirmation{Confirmation: confirmation, Signature: hex.EncodeToString(sig)}, nil
+}
+
+func (h *CliHandler) confirmShare(ctx context.Context, addr string, vk types.ValidatorPK, confirmation *shareConfirmation) error {
+	data, err := json.Marshal(confirmation)
+	if err != nil {
+		return err
+	}
+	resp, err := h.post(ctx, fmt.Sprintf("%s/shares/%x/confirm", addr, vk), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status %s", consumeError(resp))
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+)
+
+// the SSV network contract methods registering validators, and the ERC20
+// approve of the SSV token the deposited amount is transferred from
+const registerABI = `[
+	{"type":"function","name":"registerValidator","stateMutability":"nonpayable","outputs":[],"inputs":[
+		{"name":"publicKey","type":"bytes"},
+		{"name":"operatorIds","type":"uint64[]"},
+		{"name":"sharesData","type":"bytes"},
+		{"name":"amount","type":"uint256"},
+		{"name":"cluster","type":"tuple","components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"function","name":"bulkRegisterValidator","stateMutability":"nonpayable","outputs":[],"inputs":[
+		{"name":"publicKeys","type":"bytes[]"},
+		{"name":"operatorIds","type":"uint64[]"},
+		{"name":"sharesData","type":"bytes[]"},
+		{"name":"amount","type":"uint256"},
+		{"name":"cluster","type":"tuple","components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"function","name":"approve","stateMutability":"nonpayable","outputs":[{"name":"","type":"bool"}],"inputs":[
+		{"name":"spender","type":"address"},
+		{"name":"amount","type":"uint256"}]}
+]`
+
+var chainIDs = map[string]uint64{
+	"mainnet": 1,
+	"prater":  5,
+	"holesky": 17000,
+}
+
+// ClusterSnapshot is the state of a cluster in the SSV network contract as
+// printed by the ssv-scanner tool, the numbers may be JSON numbers or strings
+type ClusterSnapshot struct {
+	ValidatorCount  uint32   `json:"validatorCount"`
+	NetworkFeeIndex uint64   `json:"networkFeeIndex"`
+	Index           uint64   `json:"index"`
+	Active          bool     `json:"active"`
+	Balance         *big.Int `json:"balance"`
+}
+
+func (s *ClusterSnapshot) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ValidatorCount  json.Number `json:"validatorCount"`
+		NetworkFeeIndex json.Number `json:"networkFeeIndex"`
+		Index           json.Number `json:"index"`
+		Active          *bool       `json:"active"`
+		Balance         json.Number `json:"balance"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	validatorCount, err := strconv.ParseUint(raw.ValidatorCount.String(), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid validatorCount: %w", err)
+	}
+	if s.NetworkFeeIndex, err = strconv.ParseUint(raw.NetworkFeeIndex.String(), 10, 64); err != nil {
+		return fmt.Errorf("invalid networkFeeIndex: %w", err)
+	}
+	if s.Index, err = strconv.ParseUint(raw.Index.String(), 10, 64); err != nil {
+		return fmt.Errorf("invalid index: %w", err)
+	}
+	if s.Balance, err = parseAmount(raw.Balance.String()); err != nil {
+		return fmt.Errorf("invalid balance: %w", err)
+	}
+	s.ValidatorCount = uint32(validatorCount)
+	// a snapshot without active keeps the default of the caller
+	if raw.Active != nil {
+		s.Active = *raw.Active
+	}
+	return nil
+}
+
+// Transaction is an unsigned transaction to be sent by the cluster owner
+type Transaction struct {
+	ChainID  string `json:"chainId"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+	Data     string `json:"data"`
+	Function string `json:"function"`
+}
+
+// SafeBatch is a batch file of the Safe transaction builder app
+type SafeBatch struct {
+	Version      string            `json:"version"`
+	ChainID      string            `json:"chainId"`
+	CreatedAt    int64             `json:"createdAt"`
+	Meta         SafeBatchMeta     `json:"meta"`
+	Transactions []SafeTransaction `json:"transactions"`
+}
+
+type SafeBatchMeta struct {
+	Name                   string `json:"name"`
+	Description            string `json:"description"`
+	TxBuilderVersion       string `json:"txBuilderVersion"`
+	CreatedFromSafeAddress string `json:"createdFromSafeAddress"`
+}
+
+type SafeTransaction struct {
+	To                   string `json:"to"`
+	Value                string `json:"value"`
+	Data                 string `json:"data"`
+	ContractMethod       any    `json:"contractMethod"`
+	ContractInputsValues any    `json:"contractInputsValues"`
+}
+
+// HandleGenerateRegisterTx encodes the SSV network contract call registering
+// the validators of the keyshares files with their cluster, and writes it as
+// unsigned transactions and as a Safe transaction builder batch
+func (h *CliHandler) HandleGenerateRegisterTx(c *cli.Context) error {
+	chainID, ok := chainIDs[c.String("network")]
+	if !ok {
+		return fmt.Errorf("HandleGenerateRegisterTx: unknown network %s", c.String("network"))
+	}
+	if !common.IsHexAddress(c.String("contract")) {
+		return fmt.Errorf("HandleGenerateRegisterTx: invalid contract address %s", c.String("contract"))
+	}
+	contract := common.HexToAddress(c.String("contract"))
+	amount, err := parseAmount(c.String("amount"))
+	if err != nil {
+		return fmt.Errorf("HandleGenerateRegisterTx: invalid amount: %w", err)
+	}
+
+	keyshares, err := readKeySharesFiles(c.StringSlice("keyshares"))
+	if err != nil {
+		return fmt.Errorf("HandleGenerateRegisterTx: %w", err)
+	}
+	cluster, err := parseClusterSnapshot(c)
+	if err != nil {
+		return fmt.Errorf("HandleGenerateRegisterTx: %w", err)
+	}
+
+	txs := make([]*Transaction, 0, 2)
+	if c.IsSet("ssv-token") {
+		if !common.IsHexAddress(c.String("ssv-token")) {
+			return fmt.Errorf("HandleGenerateRegisterTx: invalid ssv token address %s", c.String("ssv-token"))
+		}
+		approve, err := approveTx(common.HexToAddress(c.String("ssv-token")), contract, amount)
+		if err != nil {
+			return fmt.Errorf("HandleGenerateRegisterTx: %w", err)
+		}
+		txs = append(txs, approve)
+	}
+	register, err := registerTx(contract, keyshares, amount, cluster)
+	if err != nil {
+		return fmt.Errorf("HandleGenerateRegisterTx: %w", err)
+	}
+	txs = append(txs, register)
+
+	owner := keyshares[0].Payload.Owner
+	for _, tx := range txs {
+		tx.ChainID = strconv.FormatUint(chainID, 10)
+		tx.From = owner
+	}
+
+	now := time.Now()
+	filename := filepath.Join(c.String("output-dir"), fmt.Sprintf("register_tx_%d.json", now.Unix()))
+	fmt.Printf("writing unsigned transactions to file: %s\n", filename)
+	if err := utils.WriteJSON(filename, txs); err != nil {
+		return fmt.Errorf("HandleGenerateRegisterTx: %w", err)
+	}
+	filename = filepath.Join(c.String("output-dir"), fmt.Sprintf("safe_batch_%d.json", now.Unix()))
+	fmt.Printf("writing safe transaction builder batch to file: %s\n", filename)
+	if err := utils.WriteJSON(filename, newSafeBatch(chainID, owner, txs, now)); err != nil {
+		return fmt.Errorf("HandleGenerateRegisterTx: %w", err)
+	}
+	return nil
+}
+
+// readKeySharesFiles reads the keyshares of validators registered in one call,
+// they have to be of the same owner and operators and have consecutive owner
+// nonces, and are ordered by nonce
+func readKeySharesFiles(paths []string) ([]*KeyShares, error) {
+	keyshares := make([]*KeyShares, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyshares file: %w", err)
+		}
+		ks := &KeyShares{}
+		if err := json.Unmarshal(data, ks); err != nil {
+			return nil, fmt.Errorf("failed to parse keyshares file %s: %w", path, err)
+		}
+		keyshares = append(keyshares, ks)
+	}
+	if len(keyshares) == 0 {
+		return nil, fmt.Errorf("--keyshares is required")
+	}
+	sort.SliceStable(keyshares, func(i, j int) bool { return keyshares[i].Payload.Nonce < keyshares[j].Payload.Nonce })
+
+	first := keyshares[0].Payload
+	publicKeys := make(map[string]bool)
+	for i, ks := range keyshares {
+		payload := ks.Payload
+		if !strings.EqualFold(payload.Owner, first.Owner) {
+			return nil, fmt.Errorf("keyshares of validator %s are of owner %s instead of %s", payload.PublicKey, payload.Owner, first.Owner)
+		}
+		if fmt.Sprint(payload.OperatorIDs) != fmt.Sprint(first.OperatorIDs) {
+			return nil, fmt.Errorf("keyshares of validator %s are of operators %v instead of %v", payload.PublicKey, payload.OperatorIDs, first.OperatorIDs)
+		}
+		if payload.Nonce != first.Nonce+i {
+			return nil, fmt.Errorf("owner nonces of the keyshares aren't consecutive, validator %s has nonce %d instead of %d", payload.PublicKey, payload.Nonce, first.Nonce+i)
+		}
+		if publicKeys[strings.ToLower(payload.PublicKey)] {
+			return nil, fmt.Errorf("validator %s is given twice", payload.PublicKey)
+		}
+		publicKeys[strings.ToLower(payload.PublicKey)] = true
+	}
+	return keyshares, nil
+}
+
+// parseClusterSnapshot reads the snapshot from --cluster-file, the snapshot
+// flags that are set override its values
+func parseClusterSnapshot(c *cli.Context) (*ClusterSnapshot, error) {
+	cluster := &ClusterSnapshot{Active: true, Balance: new(big.Int)}
+	if c.IsSet("cluster-file") {
+		data, err := os.ReadFile(c.String("cluster-file"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cluster file: %w", err)
+		}
+		if err := json.Unmarshal(data, cluster); err != nil {
+			return nil, fmt.Errorf("failed to parse cluster file: %w", err)
+		}
+	}
+	if c.IsSet("validator-count") {
+		cluster.ValidatorCount = uint32(c.Uint("validator-count"))
+	}
+	if c.IsSet("network-fee-index") {
+		cluster.NetworkFeeIndex = c.Uint64("network-fee-index")
+	}
+	if c.IsSet("index") {
+		cluster.Index = c.Uint64("index")
+	}
+	if c.IsSet("active") {
+		cluster.Active = c.Bool("active")
+	}
+	if c.IsSet("balance") {
+		balance, err := parseAmount(c.String("balance"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance: %w", err)
+		}
+		cluster.Balance = balance
+	}
+	return cluster, nil
+}
+
+func parseAmount(s string) (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(s, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("%q is not a non-negative decimal integer", s)
+	}
+	return amount, nil
+}
+
+// registerTx encodes registerValidator for a single validator and
+// bulkRegisterValidator for several
+func registerTx(contract common.Address, keyshares []*KeyShares, amount *big.Int, cluster *ClusterSnapshot) (*Transaction, error) {
+	contractABI, err := abi.JSON(strings.NewReader(registerABI))
+	if err != nil {
+		return nil, err
+	}
+
+	operatorIDs := make([]uint64, 0, len(keyshares[0].Payload.OperatorIDs))
+	for _, operatorID := range keyshares[0].Payload.OperatorIDs {
+		operatorIDs = append(operatorIDs, uint64(operatorID))
+	}
+	publicKeys := make([][]byte, 0, len(keyshares))
+	sharesData := make([][]byte, 0, len(keyshares))
+	for _, ks := range keyshares {
+		publicKey, err := hexutil.Decode(ks.Payload.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %w", ks.Payload.PublicKey, err)
+		}
+		shares, err := hexutil.Decode(ks.Payload.Shares)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shares data of validator %s: %w", ks.Payload.PublicKey, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+		sharesData = append(sharesData, shares)
+	}
+
+	var (
+		method = "registerValidator"
+		data   []byte
+	)
+	if len(keyshares) == 1 {
+		data, err = contractABI.Pack(method, publicKeys[0], operatorIDs, sharesData[0], amount, *cluster)
+	} else {
+		method = "bulkRegisterValidator"
+		data, err = contractABI.Pack(method, publicKeys, operatorIDs, sharesData, amount, *cluster)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", method, err)
+	}
+	return &Transaction{
+		To:       contract.Hex(),
+		Value:    "0",
+		Data:     hexutil.Encode(data),
+		Function: contractABI.Methods[method].Sig,
+	}, nil
+}
+
+// approveTx encodes the approval of the SSV token amount the contract
+// transfers from the owner when registering
+func approveTx(token, spender common.Address, amount *big.Int) (*Transaction, error) {
+	contractABI, err := abi.JSON(strings.NewReader(registerABI))
+	if err != nil {
+		return nil, err
+	}
+	data, err := contractABI.Pack("approve", spender, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode approve: %w", err)
+	}
+	return &Transaction{
+		To:       token.Hex(),
+		Value:    "0",
+		Data:     hexutil.Encode(data),
+		Function: contractABI.Methods["approve"].Sig,
+	}, nil
+}
+
+func newSafeBatch(chainID uint64, owner string, txs []*Transaction, createdAt time.Time) *SafeBatch {
+	transactions := make([]SafeTransaction, 0, len(txs))
+	for _, tx := range txs {
+		transactions = append(transactions, SafeTransaction{To: tx.To, Value: tx.Value, Data: tx.Data})
+	}
+	return &SafeBatch{
+		Version:   "1.0",
+		ChainID:   strconv.FormatUint(chainID, 10),
+		CreatedAt: createdAt.UnixMilli(),
+		Meta: SafeBatchMeta{
+			Name:                   "SSV validator registration",
+			Description:            fmt.Sprintf("%s on the SSV network contract", txs[len(txs)-1].Function),
+			TxBuilderVersion:       "1.16.5",
+			CreatedFromSafeAddress: owner,
+		},
+		Transactions: transactions,
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestRegisterTx(t *testing.T) {
+	contractABI, err := abi.JSON(strings.NewReader(registerABI))
+	require.NoError(t, err)
+	require.Equal(t, registerValidatorSignature, contractABI.Methods["registerValidator"].Sig)
+
+	cluster := &ClusterSnapshot{}
+	require.NoError(t, json.Unmarshal([]byte(`{"validatorCount":2,"networkFeeIndex":"123","index":"456","active":true,"balance":"1000000000000000000"}`), cluster))
+
+	keyshares := []*KeyShares{
+		{Payload: Payload{PublicKey: "0xaa01", OperatorIDs: []uint32{1, 2, 3, 4}, Shares: "0xbb01", Nonce: 3}},
+		{Payload: Payload{PublicKey: "0xaa02", OperatorIDs: []uint32{1, 2, 3, 4}, Shares: "0xbb02", Nonce: 4}},
+	}
+	contract := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	amount := big.NewInt(5)
+
+	for _, test := range []struct {
+		keyshares []*KeyShares
+		method    string
+	}{
+		{keyshares[:1], "registerValidator"},
+		{keyshares, "bulkRegisterValidator"},
+	} {
+		tx, err := registerTx(contract, test.keyshares, amount, cluster)
+		require.NoError(t, err)
+		require.Equal(t, contract.Hex(), tx.To)
+
+		data, err := hexutil.Decode(tx.Data)
+		require.NoError(t, err)
+		method, err := contractABI.MethodById(data[:4])
+		require.NoError(t, err)
+		require.Equal(t, test.method, method.Name)
+
+		args, err := method.Inputs.Unpack(data[4:])
+		require.NoError(t, err)
+		require.Equal(t, []uint64{1, 2, 3, 4}, args[1])
+		require.Equal(t, amount, args[3])
+		if len(test.keyshares) > 1 {
+			require.Equal(t, [][]byte{{0xaa, 0x01}, {0xaa, 0x02}}, args[0])
+			require.Equal(t, [][]byte{{0xbb, 0x01}, {0xbb, 0x02}}, args[2])
+		} else {
+			require.Equal(t, []byte{0xaa, 0x01}, args[0])
+			require.Equal(t, []byte{0xbb, 0x01}, args[2])
+		}
+
+		var decoded ClusterSnapshot
+		require.NoError(t, method.Inputs.Copy(&[]any{nil, nil, nil, nil, &decoded}, args))
+		require.Equal(t, *cluster, decoded)
+	}
+}
+
+func TestParseClusterSnapshot(t *testing.T) {
+	parse := func(snapshot string) *ClusterSnapshot {
+		path := filepath.Join(t.TempDir(), "cluster.json")
+		require.NoError(t, os.WriteFile(path, []byte(snapshot), 0o600))
+		set := flag.NewFlagSet("generate-register-tx", flag.ContinueOnError)
+		set.String("cluster-file", "", "")
+		require.NoError(t, set.Parse([]string{"--cluster-file", path}))
+		cluster, err := parseClusterSnapshot(cli.NewContext(cli.NewApp(), set, nil))
+		require.NoError(t, err)
+		return cluster
+	}
+
+	// a cluster file without active, as of a new cluster, is active
+	require.True(t, parse(`{"validatorCount":0,"networkFeeIndex":0,"index":0,"balance":0}`).Active)
+	require.False(t, parse(`{"validatorCount":0,"networkFeeIndex":0,"index":0,"active":false,"balance":0}`).Active)
+}
@@ -23,25 +23,58 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/herumi/bls-eth-go-binary/bls"
 	"github.com/urfave/cli/v2"
 )
 
+const (
+	reshareResultRetries  = 30
+	reshareResultInterval = 2 * time.Second
+)
+
+// HandleResharing reshares the validator key from the old to the new
+// operators. Unless --no-wait is set, it waits for the result, checks that the
+// new shares are of the same validator key, and writes the new keyshares and a
+// migration bundle with the SSV contract calls moving the validator.
 func (h *CliHandler) HandleResharing(c *cli.Context) error {
 	resharingRequest := &ResharingRequest{}
 	if err := resharingRequest.parseResharingRequest(c); err != nil {
 		return fmt.Errorf("HandleResharing: failed to parse resharing request: %w", err)
 	}
 
+	vk, err := parseValidatorPK(resharingRequest.ValidatorPK)
+	if err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	resharingRequest.ValidatorPK = hex.EncodeToString(vk)
+	if !c.Bool("no-wait") {
+		for _, flag := range []string{"owner-address", "owner-nonce", "network"} {
+			if !c.IsSet(flag) {
+				return fmt.Errorf("HandleResharing: --%s is required to generate the keyshares, unless --no-wait is set", flag)
+			}
+		}
+	}
+
+	if err := h.preflightResharing(c.Context, resharingRequest); err != nil {
+		return fmt.Errorf("HandleResharing: preflight failed: %w", err)
+	}
+
 	requestID := getRandRequestID()
 	requestIDInHex := hex.EncodeToString(requestID[:])
 
@@ -49,8 +82,8 @@ func (h *CliHandler) HandleResharing(c *cli.Context) error {
 	operatorsOld := resharingRequest.oldOperators()
 	alloperators := append(operators, operatorsOld...)
 
-	messengerClient := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
-	if err := messengerClient.CreateTopic(requestIDInHex, alloperators); err != nil {
+	messengerClient, err := h.openCeremony(c, requestIDInHex, alloperators)
+	if err != nil {
 		return fmt.Errorf("HandleResharing: failed to createa new topic on messenger service: %w", err)
 	}
 
@@ -58,32 +91,176 @@ func (h *CliHandler) HandleResharing(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("HandleResharing: failed to generate init message for keygen: %w", err)
 	}
+	h.recordInitMsg(messengerClient, requestIDInHex, initMsgBytes)
 
 	for _, operatorID := range alloperators {
 		addr := resharingRequest.nodeAddress(operatorID)
-		if err := h.sendReshareMsg(operatorID, addr, initMsgBytes); err != nil {
+		if err := h.sendReshareMsg(c.Context, operatorID, addr, initMsgBytes); err != nil {
 			return err
 		}
 	}
 
 	fmt.Printf("resharing init request sent with ID: %s\n", requestIDInHex)
+	if c.Bool("no-wait") {
+		return nil
+	}
+
+	result, err := h.waitForReshare(requestIDInHex, operators)
+	if err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	if err := writeResults(requestIDInHex, result); err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	if result.Blame != nil {
+		return fmt.Errorf("HandleResharing: resharing ceremony %s failed, get-dkg-results shows the blame", requestIDInHex)
+	}
+	if err := checkReshareResult(vk, resharingRequest.Threshold, result); err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+
+	keyshares, err := h.writeKeyShares(c, vk, result)
+	if err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	bundle := newMigrationBundle(requestIDInHex, operatorsOld, keyshares)
+	filename := fmt.Sprintf("migration_%s_%d.json", requestIDInHex, time.Now().Unix())
+	fmt.Printf("writing migration bundle to file: %s\n", filename)
+	if err := utils.WriteJSON(filename, bundle); err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	fmt.Printf("once the validator is registered with the new cluster, run retire-shares with request id %s to delete the shares of the operators that left\n", requestIDInHex)
 	return nil
 }
 
-func (h *CliHandler) sendReshareMsg(operatorID types.OperatorID, addr string, data []byte) error {
-	url := fmt.Sprintf("%s/consume", addr)
-	resp, err := h.client.Post(url, "application/json", bytes.NewBuffer(data))
+// waitForReshare polls the results until the outputs of all new operators or
+// a blame arrived
+func (h *CliHandler) waitForReshare(requestID string, operators []types.OperatorID) (*DKGResult, error) {
+	var (
+		result *DKGResult
+		err    error
+	)
+	for try := 0; try < reshareResultRetries; try++ {
+		result, err = h.DKGResultByRequestID(requestID)
+		if err == nil && (result.Blame != nil || hasOutputs(result, operators)) {
+			return result, nil
+		}
+		if err == nil {
+			// the ceremony can't finish once an operator refused it
+			if err = result.Rejected(); err != nil {
+				break
+			}
+		}
+		time.Sleep(reshareResultInterval)
+	}
+	if err == nil {
+		err = fmt.Errorf("not all of the operators %v sent their output", operators)
+	}
+	return nil, fmt.Errorf("failed to get result of resharing ceremony %s: %w", requestID, err)
+}
+
+func hasOutputs(result *DKGResult, operators []types.OperatorID) bool {
+	for _, operatorID := range operators {
+		if _, ok := result.Output[operatorID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *CliHandler) sendReshareMsg(ctx context.Context, operatorID types.OperatorID, addr string, data []byte) error {
+	resp, err := h.post(ctx, fmt.Sprintf("%s/consume", addr), data)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to send reshare message with code %d to operator %d", resp.StatusCode, operatorID)
+		return fmt.Errorf("failed to send reshare message to operator %d: %s", operatorID, consumeError(resp))
 	}
 	return nil
 }
 
+// preflightResharing checks that the new operators can hold the validator at
+// the threshold, and asks every old operator for its share to check that they
+// hold shares of the validator key and can meet the threshold of the cluster
+func (h *CliHandler) preflightResharing(ctx context.Context, request *ResharingRequest) error {
+	if request.Threshold < 2 || request.Threshold > len(request.Operators) {
+		return fmt.Errorf("threshold %d doesn't fit the %d new operators", request.Threshold, len(request.Operators))
+	}
+	vk, err := parseValidatorPK(request.ValidatorPK)
+	if err != nil {
+		return err
+	}
+	if len(request.OperatorsOld) == 0 {
+		return fmt.Errorf("--old-operator is required")
+	}
+
+	errs := make([]error, 0)
+	infos := make(map[types.OperatorID]*storage.ShareInfo)
+	for operatorID, addr := range request.OperatorsOld {
+		info, err := h.getShareInfo(ctx, addr, vk)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("old operator %d: %w", operatorID, err))
+			continue
+		}
+		if info.Retired != nil {
+			errs = append(errs, fmt.Errorf("old operator %d retired its share after resharing %s", operatorID, info.Retired.RequestID))
+			continue
+		}
+		infos[operatorID] = info
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// the threshold and operators of the cluster the validator was shared to
+	var threshold uint64
+	for operatorID, info := range infos {
+		if threshold != 0 && info.Threshold != threshold {
+			return fmt.Errorf("old operators hold shares of different thresholds %d and %d", threshold, info.Threshold)
+		}
+		threshold = info.Threshold
+		if !containsOperator(info.OperatorIDs, operatorID) {
+			return fmt.Errorf("old operator %d holds a share of the cluster %v it isn't part of", operatorID, info.OperatorIDs)
+		}
+	}
+	if len(infos) < int(threshold) {
+		return fmt.Errorf("%d old operators can't meet the threshold %d of the cluster", len(infos), threshold)
+	}
+
+	sharePKs := make(map[types.OperatorID]string)
+	for operatorID, info := range infos {
+		sharePKs[operatorID] = info.SharePubKey
+	}
+	return checkSharePubKeys(vk, int(threshold), sharePKs)
+}
+
+func containsOperator(operators []types.OperatorID, operatorID types.OperatorID) bool {
+	for _, id := range operators {
+		if id == operatorID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *CliHandler) getShareInfo(ctx context.Context, addr string, vk types.ValidatorPK) (*storage.ShareInfo, error) {
+	resp, err := h.send(ctx, http.MethodGet, fmt.Sprintf("%s/shares/%x", addr, vk), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request for its share failed with status %s", consumeError(resp))
+	}
+	info := &storage.ShareInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, fmt.Errorf("failed to parse share: %w", err)
+	}
+	return info, nil
+}
+
 type ResharingRequest struct {
 	Operators    map[types.OperatorID]string `json:"operators"`
 	Threshold    int                         `json:"threshold"`
@@ -182,3 +359,70 @@ func (request *ResharingRequest) initMsgForResharing(requestID dkg.RequestID) ([
 	}
 	return msg.Encode()
 }
+
+// checkReshareResult checks that the result of a resharing holds a share of
+// the validator key for every operator
+func checkReshareResult(vk types.ValidatorPK, threshold int, result *DKGResult) error {
+	resultVK, err := result.GetValidatorPK()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(resultVK, vk) {
+		return fmt.Errorf("resharing result is of validator %x instead of %x", resultVK, vk)
+	}
+	sharePKs := make(map[types.OperatorID]string)
+	for operatorID, output := range result.Output {
+		sharePKs[operatorID] = output.Data.SharePubKey
+	}
+	return checkSharePubKeys(vk, threshold, sharePKs)
+}
+
+// checkSharePubKeys interpolates the validator public key from the share
+// public keys of a threshold of the operators and swaps in each other one
+func checkSharePubKeys(vk types.ValidatorPK, threshold int, sharePKs map[types.OperatorID]string) error {
+	if threshold < 1 || threshold > len(sharePKs) {
+		return fmt.Errorf("threshold %d is invalid for %d operators", threshold, len(sharePKs))
+	}
+
+	operators := make([]types.OperatorID, 0, len(sharePKs))
+	for operatorID := range sharePKs {
+		operators = append(operators, operatorID)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+
+	pks := make([]bls.PublicKey, len(operators))
+	ids := make([]bls.ID, len(operators))
+	for i, operatorID := range operators {
+		if err := pks[i].DeserializeHexStr(strings.TrimPrefix(sharePKs[operatorID], "0x")); err != nil {
+			return fmt.Errorf("invalid share public key of operator %d: %w", operatorID, err)
+		}
+		if err := ids[i].SetDecString(strconv.FormatUint(uint64(operatorID), 10)); err != nil {
+			return err
+		}
+	}
+
+	interpolatesVK := func(indices []int) bool {
+		pkVec := make([]bls.PublicKey, 0, len(indices))
+		idVec := make([]bls.ID, 0, len(indices))
+		for _, i := range indices {
+			pkVec = append(pkVec, pks[i])
+			idVec = append(idVec, ids[i])
+		}
+		pk := &bls.PublicKey{}
+		return pk.Recover(pkVec, idVec) == nil && bytes.Equal(pk.Serialize(), vk)
+	}
+
+	subset := make([]int, threshold)
+	for i := range subset {
+		subset[i] = i
+	}
+	if !interpolatesVK(subset) {
+		return fmt.Errorf("share public keys of operators %v don't interpolate to the validator key", operators[:threshold])
+	}
+	for j := threshold; j < len(operators); j++ {
+		if !interpolatesVK(append([]int{j}, subset[1:]...)) {
+			return fmt.Errorf("share public key of operator %d isn't a share of the validator key", operators[j])
+		}
+	}
+	return nil
+}
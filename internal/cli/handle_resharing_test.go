@@ -0,0 +1,109 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReshareResult(t *testing.T) {
+	validatorPK, shares := testSharing(t, 3, 4)
+	vk := validatorPK.Serialize()
+	result := &DKGResult{Output: make(map[types.OperatorID]SignedOutput)}
+	for operatorID, share := range shares {
+		result.Output[operatorID] = SignedOutput{Data: Output{
+			SharePubKey:     share.GetPublicKey().SerializeToHexStr(),
+			ValidatorPubKey: hex.EncodeToString(vk),
+		}}
+	}
+	require.NoError(t, checkReshareResult(vk, 3, result))
+	require.Error(t, checkReshareResult(vk, 5, result))
+
+	// a share of another key
+	_, other := testSharing(t, 3, 4)
+	output := result.Output[4]
+	output.Data.SharePubKey = other[4].GetPublicKey().SerializeToHexStr()
+	result.Output[4] = output
+	require.ErrorContains(t, checkReshareResult(vk, 3, result), "operator 4 isn't a share")
+}
+
+func TestPreflightResharing(t *testing.T) {
+	validatorPK, shares := testSharing(t, 3, 4)
+	vk := validatorPK.Serialize()
+
+	infos := make(map[types.OperatorID]*storage.ShareInfo)
+	operators := make(map[types.OperatorID]string)
+	for operatorID, share := range shares {
+		operatorID := operatorID
+		infos[operatorID] = &storage.ShareInfo{
+			ValidatorPK: hex.EncodeToString(vk),
+			SharePubKey: share.GetPublicKey().SerializeToHexStr(),
+			Threshold:   3,
+			OperatorIDs: []types.OperatorID{1, 2, 3, 4},
+		}
+		// the handler runs off the test goroutine, a wrong request fails the preflight
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != fmt.Sprintf("/shares/%x", vk) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if infos[operatorID] == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(infos[operatorID])
+		}))
+		defer server.Close()
+		operators[operatorID] = server.URL
+	}
+	h := &CliHandler{client: http.DefaultClient, logger: logrus.New()}
+	request := func(threshold int, old ...types.OperatorID) *ResharingRequest {
+		request := &ResharingRequest{
+			Operators:    map[types.OperatorID]string{5: "", 6: "", 7: "", 8: ""},
+			OperatorsOld: make(map[types.OperatorID]string),
+			Threshold:    threshold,
+			ValidatorPK:  hex.EncodeToString(vk),
+		}
+		for _, operatorID := range old {
+			request.OperatorsOld[operatorID] = operators[operatorID]
+		}
+		return request
+	}
+
+	require.NoError(t, h.preflightResharing(context.Background(), request(3, 1, 2, 4)))
+	require.ErrorContains(t, h.preflightResharing(context.Background(), request(5, 1, 2, 4)), "doesn't fit")
+	require.ErrorContains(t, h.preflightResharing(context.Background(), request(3, 1, 2)), "can't meet the threshold")
+
+	infos[2] = nil
+	require.ErrorContains(t, h.preflightResharing(context.Background(), request(3, 1, 2, 4)), "old operator 2")
+}
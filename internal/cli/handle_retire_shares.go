@@ -0,0 +1,132 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// HandleRetireShares finishes a resharing once its result is checked. The new
+// operators are confirmed their shares, so the ones that were in the old
+// cluster too delete the shares they held before, and the operators that left
+// the cluster retire their shares and then delete them.
+func (h *CliHandler) HandleRetireShares(c *cli.Context) error {
+	request := &ResharingRequest{}
+	if err := request.parseResharingRequest(c); err != nil {
+		return fmt.Errorf("HandleRetireShares: failed to parse resharing request: %w", err)
+	}
+	vk, err := parseValidatorPK(request.ValidatorPK)
+	if err != nil {
+		return fmt.Errorf("HandleRetireShares: %w", err)
+	}
+
+	requestID := c.String("request-id")
+	result, err := h.DKGResultByRequestID(requestID)
+	if err != nil {
+		return fmt.Errorf("HandleRetireShares: failed to get dkg result for requestID %s: %w", requestID, err)
+	}
+	return h.retireShares(c, request, vk, requestID, result)
+}
+
+func (h *CliHandler) retireShares(c *cli.Context, request *ResharingRequest, vk types.ValidatorPK, requestID string, result *DKGResult) error {
+	if result.Blame != nil {
+		return fmt.Errorf("resharing %s failed, the old operators keep their shares", requestID)
+	}
+	for operatorID := range request.Operators {
+		if _, ok := result.Output[operatorID]; !ok {
+			return fmt.Errorf("resharing %s has no output of operator %d, the old operators keep their shares", requestID, operatorID)
+		}
+	}
+	if err := checkReshareResult(vk, request.Threshold, result); err != nil {
+		return fmt.Errorf("%w, the old operators keep their shares", err)
+	}
+
+	confirmation, err := h.signShareConfirmation(c, vk, requestID, result)
+	if err != nil {
+		return fmt.Errorf("%w, the old operators keep their shares", err)
+	}
+	errs := make([]error, 0)
+	for operatorID, addr := range request.Operators {
+		if err := h.confirmShare(c.Context, addr, vk, confirmation); err != nil {
+			errs = append(errs, fmt.Errorf("operator %d didn't confirm its share: %w", operatorID, err))
+		}
+	}
+	// the old operators keep their shares until every new operator holds its
+	// new share
+	if len(errs) > 0 {
+		errs = append(errs, errors.New("the old operators keep their shares"))
+		return errors.Join(errs...)
+	}
+
+	for operatorID, addr := range request.OperatorsOld {
+		if _, ok := request.Operators[operatorID]; ok {
+			continue
+		}
+		if err := h.retireShare(c.Context, addr, vk, confirmation); err != nil {
+			errs = append(errs, fmt.Errorf("old operator %d didn't retire its share: %w", operatorID, err))
+			continue
+		}
+		if err := h.deleteShare(c.Context, addr, vk); err != nil {
+			errs = append(errs, fmt.Errorf("old operator %d retired its share but didn't delete it: %w", operatorID, err))
+			continue
+		}
+		fmt.Printf("old operator %d retired and deleted its share\n", operatorID)
+	}
+	return errors.Join(errs...)
+}
+
+// retireShare sends the confirmation of the new shares to an operator that
+// left the cluster, which retires its share once the signature verifies
+func (h *CliHandler) retireShare(ctx context.Context, addr string, vk types.ValidatorPK, confirmation *shareConfirmation) error {
+	data, err := json.Marshal(confirmation)
+	if err != nil {
+		return err
+	}
+	resp, err := h.post(ctx, fmt.Sprintf("%s/shares/%x/retire", addr, vk), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status %s", consumeError(resp))
+	}
+	return nil
+}
+
+func (h *CliHandler) deleteShare(ctx context.Context, addr string, vk types.ValidatorPK) error {
+	resp, err := h.send(ctx, http.MethodDelete, fmt.Sprintf("%s/shares/%x", addr, vk), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status %s", consumeError(resp))
+	}
+	return nil
+}
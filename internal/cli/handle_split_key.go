@@ -0,0 +1,180 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keymanager"
+	"github.com/RockX-SG/frost-dkg-demo/internal/keystore"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/urfave/cli/v2"
+)
+
+// HandleSplitKey splits the key of an existing validator into shares of the
+// operators and writes the same dkg result and keyshares files as a keygen
+// ceremony, so the validator can be registered on SSV without a new deposit
+func (h *CliHandler) HandleSplitKey(c *cli.Context) error {
+	network := c.String("network")
+	password, err := readPassword(c.String("password-file"))
+	if err != nil {
+		return fmt.Errorf("HandleSplitKey: %w", err)
+	}
+	sk, err := readValidatorKeystore(c.String("keystore"), password)
+	if err != nil {
+		return fmt.Errorf("HandleSplitKey: %w", err)
+	}
+
+	operators := make([]*dkg.Operator, 0)
+	for _, id := range c.IntSlice("operator-id") {
+		operator, err := storage.FetchOperatorFromNetwork(network, types.OperatorID(id))
+		if err != nil {
+			return fmt.Errorf("HandleSplitKey: failed to get operator %d from operator registry: %w", id, err)
+		}
+		operators = append(operators, operator)
+	}
+
+	requestID := getRandRequestID()
+	result, err := splitKey(sk, operators, c.Int("threshold"), hex.EncodeToString(requestID[:]))
+	if err != nil {
+		return fmt.Errorf("HandleSplitKey: %w", err)
+	}
+
+	// the owner signature proves the validator key to the SSV contract, it is
+	// signed with the whole key since it is at hand
+	vk := sk.GetPublicKey().Serialize()
+	ownerAddress := common.HexToAddress(c.String("owner-address")).Hex()
+	ownerNonce := c.Int("owner-nonce")
+	signingRoot, err := (&signing.Payload{
+		Type: signing.TypeSSVOwnerNonce,
+		OwnerNonce: &signing.OwnerNonce{
+			Owner: ownerAddress,
+			Nonce: uint64(ownerNonce),
+		},
+	}).SigningRoot(vk)
+	if err != nil {
+		return fmt.Errorf("HandleSplitKey: failed to compute owner prefix: %w", err)
+	}
+	ownerSig := hex.EncodeToString(sk.SignByte(signingRoot).Serialize())
+
+	keyshares := &KeyShares{}
+	if err := keyshares.GenerateKeyshareV4(result, network, ownerSig, ownerAddress, ownerNonce); err != nil {
+		return fmt.Errorf("HandleSplitKey: failed to generate keyshares: %w", err)
+	}
+
+	resultFile := filepath.Join(c.String("output-dir"), fmt.Sprintf("dkg_results_%x_%d.json", requestID, time.Now().Unix()))
+	fmt.Printf("writing results to file: %s\n", resultFile)
+	if err := utils.WriteJSON(resultFile, result); err != nil {
+		return err
+	}
+	keysharesFile := filepath.Join(c.String("output-dir"), fmt.Sprintf("keyshares-%d.json", time.Now().Unix()))
+	fmt.Printf("writing keyshares to file: %s\n", keysharesFile)
+	return utils.WriteJSON(keysharesFile, keyshares)
+}
+
+func readValidatorKeystore(path, password string) (*bls.SecretKey, error) {
+	ks, err := keystore.ReadEIP2335FromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ks.Decrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	sk := &bls.SecretKey{}
+	if err := sk.Deserialize(secret); err != nil {
+		return nil, fmt.Errorf("invalid validator key: %w", err)
+	}
+
+	pubKey, err := ks.PubKeyBytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of keystore %s: %w", path, err)
+	}
+	if !bytes.Equal(pubKey, sk.GetPublicKey().Serialize()) {
+		return nil, fmt.Errorf("key of keystore %s doesn't match its public key %s", path, ks.PubKey)
+	}
+	return sk, nil
+}
+
+// splitKey Shamir-splits the validator key so that any threshold of the shares
+// of the operators recover it. Every share is encrypted to the encryption key
+// of its operator like the shares of a keygen ceremony.
+func splitKey(sk *bls.SecretKey, operators []*dkg.Operator, threshold int, requestID string) (*DKGResult, error) {
+	if threshold < 2 || threshold > len(operators) {
+		return nil, fmt.Errorf("threshold %d is invalid for %d operators", threshold, len(operators))
+	}
+
+	// the validator key is the constant term of a random polynomial of degree
+	// threshold-1, the share of an operator is its value at the operator ID
+	msk := make([]bls.SecretKey, threshold)
+	msk[0] = *sk
+	for i := 1; i < threshold; i++ {
+		msk[i].SetByCSPRNG()
+	}
+
+	sort.Slice(operators, func(i, j int) bool { return operators[i].OperatorID < operators[j].OperatorID })
+	signer := keymanager.NewKeyManager(types.PrimusTestnet)
+	vk := hex.EncodeToString(sk.GetPublicKey().Serialize())
+	result := &DKGResult{Output: make(map[types.OperatorID]SignedOutput)}
+	for _, operator := range operators {
+		if _, ok := result.Output[operator.OperatorID]; ok {
+			return nil, fmt.Errorf("operator %d is given twice", operator.OperatorID)
+		}
+
+		var id bls.ID
+		if err := id.SetDecString(strconv.FormatUint(uint64(operator.OperatorID), 10)); err != nil {
+			return nil, err
+		}
+		share := &bls.SecretKey{}
+		if err := share.Set(msk, &id); err != nil {
+			return nil, fmt.Errorf("failed to compute share of operator %d: %w", operator.OperatorID, err)
+		}
+
+		// SSV nodes decrypt the share to its hex string
+		encryptedShare, err := signer.Encrypt(operator.EncryptionPubKey, []byte(share.SerializeToHexStr()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt share of operator %d: %w", operator.OperatorID, err)
+		}
+
+		result.Output[operator.OperatorID] = SignedOutput{
+			Data: Output{
+				RequestID:       requestID,
+				EncryptedShare:  hex.EncodeToString(encryptedShare),
+				SharePubKey:     share.GetPublicKey().SerializeToHexStr(),
+				ValidatorPubKey: vk,
+			},
+		}
+	}
+	return result, nil
+}
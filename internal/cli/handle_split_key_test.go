@@ -0,0 +1,78 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keymanager"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitKey(t *testing.T) {
+	initBLS(t)
+	sk := &bls.SecretKey{}
+	sk.SetByCSPRNG()
+	vk := sk.GetPublicKey().Serialize()
+
+	keys := make(map[types.OperatorID]*rsa.PrivateKey)
+	operators := make([]*dkg.Operator, 0)
+	for _, operatorID := range []types.OperatorID{4, 12, 7, 30} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		keys[operatorID] = key
+		operators = append(operators, &dkg.Operator{OperatorID: operatorID, EncryptionPubKey: &key.PublicKey})
+	}
+
+	_, err := splitKey(sk, operators, 5, "")
+	require.Error(t, err)
+
+	result, err := splitKey(sk, operators, 3, "")
+	require.NoError(t, err)
+	resultVK, err := result.GetValidatorPK()
+	require.NoError(t, err)
+	require.Equal(t, types.ValidatorPK(vk), resultVK)
+
+	// the operators decrypt their shares, any three of them recover the key
+	signer := keymanager.NewKeyManager(types.PrimusTestnet)
+	shares := make(map[types.OperatorID]*bls.SecretKey)
+	sharePKs := make(map[types.OperatorID]string)
+	for operatorID, output := range result.Output {
+		encryptedShare, err := hex.DecodeString(output.Data.EncryptedShare)
+		require.NoError(t, err)
+		decrypted, err := signer.Decrypt(keys[operatorID], encryptedShare)
+		require.NoError(t, err)
+		share := &bls.SecretKey{}
+		require.NoError(t, share.SetHexString(string(decrypted)))
+		shares[operatorID] = share
+		sharePKs[operatorID] = output.Data.SharePubKey
+	}
+	recovered, err := reconstructKey(vk, map[types.OperatorID]*bls.SecretKey{4: shares[4], 7: shares[7], 30: shares[30]}, sharePKs)
+	require.NoError(t, err)
+	require.True(t, recovered.IsEqual(sk))
+}
@@ -0,0 +1,125 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// ExitRequest is a validator to exit, as given on the command line or as an
+// entry of the batch file
+type ExitRequest struct {
+	ValidatorPK    string `json:"validator_pk"`
+	ValidatorIndex uint64 `json:"validator_index"`
+}
+
+func (h *CliHandler) HandleVoluntaryExit(c *cli.Context) error {
+	requests, err := parseExitRequests(c)
+	if err != nil {
+		return fmt.Errorf("HandleVoluntaryExit: %w", err)
+	}
+
+	// in batch mode the exits of the other validators are still signed if one fails
+	errs := make([]error, 0)
+	for _, request := range requests {
+		if err := h.signVoluntaryExit(c, request); err != nil {
+			errs = append(errs, fmt.Errorf("HandleVoluntaryExit: validator %d: %w", request.ValidatorIndex, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func parseExitRequests(c *cli.Context) ([]*ExitRequest, error) {
+	if c.String("batch-file") == "" {
+		if !c.IsSet("validator-pk") || !c.IsSet("validator-index") {
+			return nil, fmt.Errorf("--validator-pk and --validator-index or --batch-file are required")
+		}
+		return []*ExitRequest{{
+			ValidatorPK:    c.String("validator-pk"),
+			ValidatorIndex: c.Uint64("validator-index"),
+		}}, nil
+	}
+
+	data, err := os.ReadFile(c.String("batch-file"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch file: %w", err)
+	}
+	requests := make([]*ExitRequest, 0)
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return nil, fmt.Errorf("failed to parse batch file: %w", err)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("batch file %s has no validators", c.String("batch-file"))
+	}
+	return requests, nil
+}
+
+func (h *CliHandler) signVoluntaryExit(c *cli.Context, request *ExitRequest) error {
+	vk, err := parseValidatorPK(request.ValidatorPK)
+	if err != nil {
+		return err
+	}
+
+	exit := &phase0.VoluntaryExit{
+		Epoch:          phase0.Epoch(c.Uint64("epoch")),
+		ValidatorIndex: phase0.ValidatorIndex(request.ValidatorIndex),
+	}
+	sig, err := h.SignPayload(c, vk, &signing.Payload{
+		Type:          signing.TypeVoluntaryExit,
+		Network:       c.String("network"),
+		VoluntaryExit: exit,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign voluntary exit: %w", err)
+	}
+
+	signedExit := &phase0.SignedVoluntaryExit{Message: exit}
+	copy(signedExit.Signature[:], sig)
+
+	filename := filepath.Join(c.String("output-dir"), fmt.Sprintf("voluntary_exit_%d_%d.json", request.ValidatorIndex, time.Now().Unix()))
+	fmt.Printf("writing signed voluntary exit of validator %d to file: %s\n", request.ValidatorIndex, filename)
+	return utils.WriteJSON(filename, signedExit)
+}
+
+func parseValidatorPK(s string) (types.ValidatorPK, error) {
+	vk, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator public key %s: %w", s, err)
+	}
+	if len(vk) != len(phase0.BLSPubKey{}) {
+		return nil, fmt.Errorf("invalid validator public key %s, must be %d bytes", s, len(phase0.BLSPubKey{}))
+	}
+	return vk, nil
+}
@@ -63,7 +63,9 @@ type Payload struct {
 	Nonce       int      `json:"ownerNonce"`
 }
 
-func (ks *KeyShares) GenerateKeyshareV4(result *DKGResult, ownerSig, ownerAddress string, ownerNonce int) error {
+// GenerateKeyshareV4 looks up the operators of the result in the registry of
+// the network
+func (ks *KeyShares) GenerateKeyshareV4(result *DKGResult, network, ownerSig, ownerAddress string, ownerNonce int) error {
 
 	if result.Blame != nil {
 		return fmt.Errorf("ParseDKGResultV4: result contains blame output")
@@ -77,7 +79,7 @@ func (ks *KeyShares) GenerateKeyshareV4(result *DKGResult, ownerSig, ownerAddres
 	operatorIds := make([]uint32, 0)
 
 	for operatorID := range result.Output {
-		operator, err := storage.FetchOperatorByID(operatorID)
+		operator, err := storage.FetchOperatorFromNetwork(network, operatorID)
 		if err != nil {
 			return fmt.Errorf("ParseDKGResultV4: failed to get operator %d from operator registry: %w", operatorID, err)
 		}
@@ -0,0 +1,217 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ping"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	DefaultLocalMessengerTimeout = 10 * time.Minute
+
+	localMessengerPollInterval    = time.Second
+	localMessengerShutdownTimeout = 5 * time.Second
+)
+
+// localMessenger is a messenger run by the cli for the duration of a single
+// ceremony, so that a small group of operators doesn't have to deploy one.
+// The operator nodes must use it as their MESSENGER_SRV_ADDR.
+type localMessenger struct {
+	messenger *messenger.Messenger
+	runner    *workers.Runner
+	srv       *http.Server
+	// addr is the url the cli uses to reach the messenger
+	addr   string
+	logger *logrus.Logger
+}
+
+func startLocalMessenger(logger *logrus.Logger, listenAddr string) (*localMessenger, error) {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+
+	runner := workers.NewRunner(logger)
+	go runner.Run()
+	m := messenger.New(logger, runner)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery(), tracing.Middleware())
+	m.RegisterRoutes(r, false)
+	r.GET("/ping", ping.HandlePing)
+
+	lm := &localMessenger{
+		messenger: m,
+		runner:    runner,
+		srv:       &http.Server{Handler: r},
+		addr:      "http://" + dialAddr(ln.Addr().(*net.TCPAddr)),
+		logger:    logger,
+	}
+	go func() {
+		if err := lm.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("local messenger stopped: %v", err)
+		}
+	}()
+	logger.Infof("local messenger listening on %s", ln.Addr().String())
+	return lm, nil
+}
+
+// dialAddr replaces an unspecified listen host by the loopback address
+func dialAddr(addr *net.TCPAddr) string {
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(addr.Port))
+	}
+	return addr.String()
+}
+
+// preregister subscribes the operators with the given node addresses, for
+// nodes that are registered with another messenger
+func (lm *localMessenger) preregister(operators map[types.OperatorID]string) error {
+	for operatorID, addr := range operators {
+		subscriber := &messenger.Subscriber{
+			Name:    strconv.Itoa(int(operatorID)),
+			SrvAddr: addr,
+		}
+		if err := lm.messenger.Register(subscriber, messenger.DefaultTopic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForOperators waits for the nodes of all operators to register
+func (lm *localMessenger) waitForOperators(operators []types.OperatorID, timeout time.Duration) error {
+	names := make([]string, 0, len(operators))
+	for _, operatorID := range operators {
+		names = append(names, strconv.Itoa(int(operatorID)))
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		unregistered := lm.messenger.Unregistered(names)
+		if len(unregistered) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("operators %v didn't register within %s", unregistered, timeout)
+		}
+		lm.logger.Debugf("waiting for operators %v to register", unregistered)
+		time.Sleep(localMessengerPollInterval)
+	}
+}
+
+// waitForResult waits for the nodes to stream the dkg output or blame of the ceremony
+func (lm *localMessenger) waitForResult(requestID string, timeout time.Duration) (*DKGResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if data, ok := lm.messenger.Result(requestID); ok {
+			return formatResults(data), nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no result for request %s within %s", requestID, timeout)
+		}
+		time.Sleep(localMessengerPollInterval)
+	}
+}
+
+func (lm *localMessenger) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), localMessengerShutdownTimeout)
+	defer cancel()
+	if err := lm.srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	return lm.runner.Shutdown(ctx)
+}
+
+// startLocalMessengerFromFlags returns nil unless --local-messenger is set. The
+// cli then talks to the local messenger instead of MESSENGER_SRV_ADDR.
+func (h *CliHandler) startLocalMessengerFromFlags(c *cli.Context, operators map[types.OperatorID]string) (*localMessenger, error) {
+	listenAddr := c.String("local-messenger")
+	if listenAddr == "" {
+		return nil, nil
+	}
+	if c.Bool("p2p") {
+		return nil, fmt.Errorf("--local-messenger can't be used with --p2p")
+	}
+
+	lm, err := startLocalMessenger(h.logger, listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Bool("preregister") {
+		err = lm.preregister(operators)
+	} else {
+		fmt.Printf("waiting for the operator nodes to register with the local messenger on %s\n", listenAddr)
+		ids := make([]types.OperatorID, 0, len(operators))
+		for operatorID := range operators {
+			ids = append(ids, operatorID)
+		}
+		err = lm.waitForOperators(ids, c.Duration("local-messenger-timeout"))
+	}
+	if err != nil {
+		lm.Close()
+		return nil, err
+	}
+
+	h.messengerAddr = lm.addr
+	h.resultsAddr = lm.addr
+	return lm, nil
+}
+
+func localMessengerFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "local-messenger",
+		Usage: "host:port to run a messenger for this ceremony in the cli. The operator nodes must use it as their MESSENGER_SRV_ADDR",
+	}
+}
+
+func preregisterFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "preregister",
+		Usage: "with --local-messenger, subscribe the operators with the given node addresses instead of waiting for their nodes to register",
+	}
+}
+
+func localMessengerTimeoutFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "local-messenger-timeout",
+		Usage: "with --local-messenger, how long to wait for the nodes to register and for the ceremony to finish",
+		Value: DefaultLocalMessengerTimeout,
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const (
+	removeValidatorSignature   = "removeValidator(bytes,uint64[],(uint32,uint64,uint64,bool,uint256))"
+	registerValidatorSignature = "registerValidator(bytes,uint64[],bytes,uint256,(uint32,uint64,uint64,bool,uint256))"
+)
+
+// MigrationBundle describes the SSV contract calls moving a validator from the
+// cluster of the old operators to the cluster of the new operators. The
+// cluster snapshots the calls need change with every block, they are read
+// with the ssv-scanner tool right before sending each call.
+type MigrationBundle struct {
+	Version        string          `json:"version"`
+	RequestID      string          `json:"requestId"`
+	PublicKey      string          `json:"publicKey"`
+	Owner          string          `json:"ownerAddress"`
+	OldOperatorIDs []uint32        `json:"oldOperatorIds"`
+	NewOperatorIDs []uint32        `json:"newOperatorIds"`
+	Steps          []MigrationStep `json:"steps"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+type MigrationStep struct {
+	Action      string   `json:"action"`
+	Function    string   `json:"function"`
+	PublicKey   string   `json:"publicKey"`
+	OperatorIDs []uint32 `json:"operatorIds"`
+	SharesData  string   `json:"sharesData,omitempty"`
+	Description string   `json:"description"`
+}
+
+// newMigrationBundle builds the steps removing the validator from the old
+// cluster and registering it with the new cluster from the new keyshares
+func newMigrationBundle(requestID string, oldOperators []types.OperatorID, keyshares *KeyShares) *MigrationBundle {
+	oldOperatorIDs := make([]uint32, 0, len(oldOperators))
+	for _, operatorID := range oldOperators {
+		oldOperatorIDs = append(oldOperatorIDs, uint32(operatorID))
+	}
+	sort.Slice(oldOperatorIDs, func(i, j int) bool { return oldOperatorIDs[i] < oldOperatorIDs[j] })
+
+	payload := keyshares.Payload
+	return &MigrationBundle{
+		Version:        "v1",
+		RequestID:      requestID,
+		PublicKey:      payload.PublicKey,
+		Owner:          payload.Owner,
+		OldOperatorIDs: oldOperatorIDs,
+		NewOperatorIDs: payload.OperatorIDs,
+		Steps: []MigrationStep{
+			{
+				Action:      "removeValidator",
+				Function:    removeValidatorSignature,
+				PublicKey:   payload.PublicKey,
+				OperatorIDs: oldOperatorIDs,
+				Description: fmt.Sprintf("remove the validator from the cluster of operators %v, the cluster snapshot is read with ssv-scanner for the owner and these operators", oldOperatorIDs),
+			},
+			{
+				Action:      "registerValidator",
+				Function:    registerValidatorSignature,
+				PublicKey:   payload.PublicKey,
+				OperatorIDs: payload.OperatorIDs,
+				SharesData:  payload.Shares,
+				Description: fmt.Sprintf("register the validator with the cluster of operators %v, the cluster snapshot is read with ssv-scanner after the removal and the amount deposits SSV to the cluster", payload.OperatorIDs),
+			},
+		},
+		CreatedAt: time.Now().UTC(),
+	}
+}
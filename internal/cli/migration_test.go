@@ -0,0 +1,55 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMigrationBundle(t *testing.T) {
+	keyshares := &KeyShares{
+		Payload: Payload{
+			PublicKey:   "0xabcd",
+			OperatorIDs: []uint32{2, 5, 6, 7},
+			Shares:      "0x1234",
+			Owner:       "0x0000000000000000000000000000000000000001",
+			Nonce:       3,
+		},
+	}
+	bundle := newMigrationBundle("01", []types.OperatorID{4, 1, 3, 2}, keyshares)
+
+	require.Equal(t, []uint32{1, 2, 3, 4}, bundle.OldOperatorIDs)
+	require.Equal(t, []uint32{2, 5, 6, 7}, bundle.NewOperatorIDs)
+	require.Len(t, bundle.Steps, 2)
+
+	remove, register := bundle.Steps[0], bundle.Steps[1]
+	require.Equal(t, "removeValidator", remove.Action)
+	require.Equal(t, bundle.OldOperatorIDs, remove.OperatorIDs)
+	require.Empty(t, remove.SharesData)
+	require.Equal(t, "registerValidator", register.Action)
+	require.Equal(t, bundle.NewOperatorIDs, register.OperatorIDs)
+	require.Equal(t, "0x1234", register.SharesData)
+	require.Equal(t, "0xabcd", register.PublicKey)
+}
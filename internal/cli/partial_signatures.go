@@ -0,0 +1,262 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/urfave/cli/v2"
+)
+
+// AggregationReport lists the operators whose partial signatures were used and
+// the ones that were left out with the reason
+type AggregationReport struct {
+	Threshold uint64
+	Used      []types.OperatorID
+	Invalid   map[types.OperatorID]error
+}
+
+func (r *AggregationReport) print() {
+	if len(r.Used) > 0 {
+		fmt.Printf("aggregated the partial signatures of operators %v with threshold %d\n", r.Used, r.Threshold)
+	}
+	if len(r.Invalid) > 0 {
+		fmt.Println("operators with invalid partial signatures:")
+	}
+	operators := make([]types.OperatorID, 0, len(r.Invalid))
+	for operatorID := range r.Invalid {
+		operators = append(operators, operatorID)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+	for _, operatorID := range operators {
+		fmt.Printf("  operator %d: %v\n", operatorID, r.Invalid[operatorID])
+	}
+}
+
+// signWithPartials collects the partial signatures of the payload from the
+// operators and aggregates them to the signature of the validator key
+func (h *CliHandler) signWithPartials(c *cli.Context, vk types.ValidatorPK, payload *signing.Payload) ([]byte, error) {
+	keySign, err := signing.NewKeySign(vk, payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", payload.Type, err)
+	}
+	data, err := keySign.Encode()
+	if err != nil {
+		return nil, err
+	}
+	operators, err := parseOperatorList(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse operator list from command: %w", err)
+	}
+
+	requestID := getRandRequestID()
+	partials := make(map[types.OperatorID]*signing.PartialSignature)
+	failed := make(map[types.OperatorID]error)
+	for operatorID, addr := range operators {
+		partial, err := h.requestPartial(c, fmt.Sprintf("%s/keysign/partial?request_id=%x", addr, requestID), data)
+		if err != nil {
+			failed[operatorID] = err
+			continue
+		}
+		if partial.OperatorID != operatorID {
+			failed[operatorID] = fmt.Errorf("node answered as operator %d", partial.OperatorID)
+			continue
+		}
+		partials[operatorID] = partial
+	}
+
+	sig, report, err := aggregatePartials(vk, keySign.SigningRoot, partials)
+	for operatorID, err := range failed {
+		report.Invalid[operatorID] = err
+	}
+	if err != nil {
+		report.print()
+		return nil, err
+	}
+	report.print()
+	return sig.Serialize(), nil
+}
+
+func (h *CliHandler) requestPartial(c *cli.Context, url string, data []byte) (*signing.PartialSignature, error) {
+	resp, err := h.post(c.Context, url, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with status %s", consumeError(resp))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	partial := &signing.PartialSignature{}
+	if err := json.Unmarshal(body, partial); err != nil {
+		return nil, fmt.Errorf("failed to parse partial signature: %w", err)
+	}
+	return partial, nil
+}
+
+type validPartial struct {
+	operatorID types.OperatorID
+	id         bls.ID
+	sig        bls.Sign
+}
+
+// aggregatePartials verifies every partial signature against its share public
+// key and interpolates a threshold of them with Lagrange coefficients. As a
+// share public key is only claimed by its node, the first subset aggregating to
+// a signature of the validator key is trusted, and every other partial is
+// checked by swapping it into that subset.
+func aggregatePartials(vk types.ValidatorPK, signingRoot []byte, partials map[types.OperatorID]*signing.PartialSignature) (*bls.Sign, *AggregationReport, error) {
+	report := &AggregationReport{Invalid: make(map[types.OperatorID]error)}
+
+	validatorPK := &bls.PublicKey{}
+	if err := validatorPK.Deserialize(vk); err != nil {
+		return nil, report, fmt.Errorf("failed to deserialize ValidatorPK: %w", err)
+	}
+
+	valid := make([]*validPartial, 0, len(partials))
+	thresholds := make(map[uint64]int)
+	for operatorID, partial := range partials {
+		p, err := verifyPartial(operatorID, partial, signingRoot)
+		if err != nil {
+			report.Invalid[operatorID] = err
+			continue
+		}
+		valid = append(valid, p)
+		thresholds[partial.Threshold]++
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].operatorID < valid[j].operatorID })
+
+	// the threshold reported by most operators
+	for threshold, count := range thresholds {
+		if count > thresholds[report.Threshold] || count == thresholds[report.Threshold] && threshold > report.Threshold {
+			report.Threshold = threshold
+		}
+	}
+	t := int(report.Threshold)
+	if t == 0 || len(valid) < t {
+		return nil, report, fmt.Errorf("%d valid partial signatures, %d are needed", len(valid), t)
+	}
+
+	var (
+		subset []*validPartial
+		sig    *bls.Sign
+	)
+	forEachSubset(len(valid), t, func(indices []int) bool {
+		candidate := make([]*validPartial, 0, t)
+		for _, i := range indices {
+			candidate = append(candidate, valid[i])
+		}
+		if s, ok := recoverSignature(candidate, validatorPK, signingRoot); ok {
+			subset, sig = candidate, s
+			return false
+		}
+		return true
+	})
+	if sig == nil {
+		return nil, report, fmt.Errorf("no %d of the %d valid partial signatures aggregate to a signature of the validator key", t, len(valid))
+	}
+
+	inSubset := make(map[types.OperatorID]bool)
+	for _, p := range subset {
+		inSubset[p.operatorID] = true
+		report.Used = append(report.Used, p.operatorID)
+	}
+	for _, p := range valid {
+		if inSubset[p.operatorID] {
+			continue
+		}
+		swapped := append([]*validPartial{p}, subset[1:]...)
+		if _, ok := recoverSignature(swapped, validatorPK, signingRoot); !ok {
+			report.Invalid[p.operatorID] = fmt.Errorf("share public key %s isn't a share of the validator key", partials[p.operatorID].SharePubKey)
+		}
+	}
+	return sig, report, nil
+}
+
+func verifyPartial(operatorID types.OperatorID, partial *signing.PartialSignature, signingRoot []byte) (*validPartial, error) {
+	sharePK := &bls.PublicKey{}
+	if err := sharePK.DeserializeHexStr(partial.SharePubKey); err != nil {
+		return nil, fmt.Errorf("invalid share public key: %w", err)
+	}
+	p := &validPartial{operatorID: operatorID}
+	if err := p.sig.DeserializeHexStr(partial.Signature); err != nil {
+		return nil, fmt.Errorf("invalid partial signature: %w", err)
+	}
+	if !p.sig.VerifyByte(sharePK, signingRoot) {
+		return nil, fmt.Errorf("partial signature doesn't verify against share public key %s", partial.SharePubKey)
+	}
+	if err := p.id.SetDecString(strconv.FormatUint(uint64(operatorID), 10)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func recoverSignature(partials []*validPartial, validatorPK *bls.PublicKey, signingRoot []byte) (*bls.Sign, bool) {
+	sigs := make([]bls.Sign, 0, len(partials))
+	ids := make([]bls.ID, 0, len(partials))
+	for _, p := range partials {
+		sigs = append(sigs, p.sig)
+		ids = append(ids, p.id)
+	}
+	sig := &bls.Sign{}
+	if err := sig.Recover(sigs, ids); err != nil {
+		return nil, false
+	}
+	return sig, sig.VerifyByte(validatorPK, signingRoot)
+}
+
+// forEachSubset calls fn with the indices of every k of n elements in
+// lexicographic order until fn returns false
+func forEachSubset(n, k int, fn func(indices []int) bool) {
+	indices := make([]int, k)
+	for i := range indices {
+		indices[i] = i
+	}
+	for {
+		if !fn(indices) {
+			return
+		}
+		i := k - 1
+		for i >= 0 && indices[i] == n-k+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		indices[i]++
+		for j := i + 1; j < k; j++ {
+			indices[j] = indices[j-1] + 1
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func initBLS(t *testing.T) {
+	require.NoError(t, bls.Init(bls.BLS12_381))
+	require.NoError(t, bls.SetETHmode(bls.EthModeDraft07))
+}
+
+// testSharing splits a random validator key into shares of operators 1..n,
+// any threshold of which recover it
+func testSharing(t *testing.T, threshold, n int) (*bls.PublicKey, map[types.OperatorID]*bls.SecretKey) {
+	initBLS(t)
+
+	msk := make([]bls.SecretKey, threshold)
+	for i := range msk {
+		msk[i].SetByCSPRNG()
+	}
+	shares := make(map[types.OperatorID]*bls.SecretKey)
+	for operatorID := types.OperatorID(1); operatorID <= types.OperatorID(n); operatorID++ {
+		var id bls.ID
+		require.NoError(t, id.SetDecString(fmt.Sprintf("%d", operatorID)))
+		share := &bls.SecretKey{}
+		require.NoError(t, share.Set(msk, &id))
+		shares[operatorID] = share
+	}
+	return msk[0].GetPublicKey(), shares
+}
+
+func TestAggregatePartials(t *testing.T) {
+	validatorPK, shares := testSharing(t, 3, 5)
+	signingRoot := make([]byte, 32)
+	signingRoot[0] = 0x42
+
+	partial := func(share *bls.SecretKey, root []byte) *signing.PartialSignature {
+		return &signing.PartialSignature{
+			SharePubKey: share.GetPublicKey().SerializeToHexStr(),
+			Signature:   share.SignByte(root).SerializeToHexStr(),
+			Threshold:   3,
+		}
+	}
+	var fake bls.SecretKey
+	fake.SetByCSPRNG()
+
+	partials := map[types.OperatorID]*signing.PartialSignature{
+		1: partial(shares[1], signingRoot),
+		2: partial(shares[2], make([]byte, 32)),
+		3: partial(&fake, signingRoot),
+		4: partial(shares[4], signingRoot),
+	}
+	// the fake share of operator 3 verifies its own signature, no threshold of
+	// the partials reaches the validator key
+	_, report, err := aggregatePartials(validatorPK.Serialize(), signingRoot, partials)
+	require.Error(t, err)
+	require.Len(t, report.Invalid, 1)
+	require.Contains(t, report.Invalid, types.OperatorID(2))
+
+	partials[5] = partial(shares[5], signingRoot)
+	sig, report, err := aggregatePartials(validatorPK.Serialize(), signingRoot, partials)
+	require.NoError(t, err)
+	require.True(t, sig.VerifyByte(validatorPK, signingRoot))
+	require.Equal(t, []types.OperatorID{1, 4, 5}, report.Used)
+	require.Len(t, report.Invalid, 2)
+	require.Contains(t, report.Invalid, types.OperatorID(2))
+	require.Contains(t, report.Invalid, types.OperatorID(3))
+}
@@ -22,16 +22,20 @@
 package cli
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/big"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -41,6 +45,9 @@ type CliHandler struct {
 	client        *http.Client
 	logger        *logrus.Logger
 	messengerAddr string
+	// resultsAddr serves the dkg results, the messenger unless the nodes run in
+	// p2p mode, in which case any operator node of the ceremony can be used
+	resultsAddr string
 }
 
 func New(logger *logrus.Logger) *CliHandler {
@@ -51,20 +58,28 @@ func New(logger *logrus.Logger) *CliHandler {
 		client: &http.Client{
 			Timeout: 5 * time.Minute,
 			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				TLSClientConfig: tlsconfig.MustClientConfigFromEnv(),
 			},
 		},
 		logger:        logger,
 		messengerAddr: messenger.MessengerAddrFromEnv(),
+		resultsAddr:   resultsAddrFromEnv(),
 	}
 }
 
+func resultsAddrFromEnv() string {
+	if os.Getenv("DKG_RESULTS_ADDR") != "" {
+		return os.Getenv("DKG_RESULTS_ADDR")
+	}
+	return messenger.MessengerAddrFromEnv()
+}
+
 func (h CliHandler) CommandKeygen() *cli.Command {
 	return &cli.Command{
 		Name:    "keygen",
 		Aliases: []string{"k"},
 		Usage:   "start keygen process",
-		Action:  h.HandleKeygen,
+		Action:  traced(h.HandleKeygen),
 		Flags: []cli.Flag{
 			&cli.StringSliceFlag{
 				Name:     "operator",
@@ -90,6 +105,12 @@ func (h CliHandler) CommandKeygen() *cli.Command {
 				Usage:    "fork version",
 				Required: true,
 			},
+			webhookURLFlag(),
+			webhookSecretFlag(),
+			p2pFlag(),
+			localMessengerFlag(),
+			preregisterFlag(),
+			localMessengerTimeoutFlag(),
 		},
 	}
 }
@@ -99,8 +120,111 @@ func (h CliHandler) CommandResharing() *cli.Command {
 		Name:    "resharing",
 		Aliases: []string{"r"},
 		Usage:   "start resharing process",
-		Action:  h.HandleResharing,
+		Action:  traced(h.HandleResharing),
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "operator",
+				Aliases:  []string{"o"},
+				Usage:    "operator key-value pair",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "old-operator",
+				Aliases:  []string{"oo"},
+				Usage:    "old operator key-value pair",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:     "threshold",
+				Aliases:  []string{"t"},
+				Usage:    "threshold value",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "validator-pk",
+				Aliases:  []string{"vk"},
+				Usage:    "validator public key value",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "owner-address",
+				Aliases: []string{"oa"},
+				Usage:   "The cluster owner address (in the SSV contract), required unless --no-wait is set",
+			},
+			&cli.IntFlag{
+				Name:    "owner-nonce",
+				Aliases: []string{"on"},
+				Usage:   "The validator registration nonce of the account (owner address) within the SSV contract (increments after each validator registration), obtained using the ssv-scanner tool. Required unless --no-wait is set",
+			},
+			&cli.StringFlag{
+				Name:    "network",
+				Aliases: []string{"net"},
+				Usage:   "ETH network: prater, holesky, mainnet, required unless --no-wait is set",
+			},
+			&cli.BoolFlag{
+				Name:  "no-wait",
+				Usage: "only send the resharing request, without waiting for the result to write the keyshares and the migration bundle",
+			},
+			webhookURLFlag(),
+			webhookSecretFlag(),
+			p2pFlag(),
+			partialSignaturesFlag(),
+		},
+	}
+}
+
+func webhookURLFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "webhook-url",
+		Usage: "url the messenger notifies once the ceremony finishes or fails",
+	}
+}
+
+func webhookSecretFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "webhook-secret",
+		Usage:   "secret used by the messenger to sign webhook notifications (HMAC-SHA256)",
+		EnvVars: []string{"DKG_WEBHOOK_SECRET"},
+	}
+}
+
+func webhookFromFlags(c *cli.Context) *messenger.Webhook {
+	if c.String("webhook-url") == "" {
+		return nil
+	}
+	return &messenger.Webhook{
+		URL:    c.String("webhook-url"),
+		Secret: c.String("webhook-secret"),
+	}
+}
+
+func p2pFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "p2p",
+		Usage:   "the operator nodes run in p2p mode, the init message is only sent to the operators and no messenger topic is created",
+		EnvVars: []string{"DKG_P2P"},
+	}
+}
+
+func partialSignaturesFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "partial-signatures",
+		Usage: "collect the partial signature of every operator and aggregate them in the cli instead of running a keysign ceremony, operators with invalid partial signatures are reported",
+	}
+}
+
+func (h CliHandler) CommandRetireShares() *cli.Command {
+	return &cli.Command{
+		Name:   "retire-shares",
+		Usage:  "check the result of a resharing, then confirm the shares of the new operators and retire and delete the shares of the operators that left",
+		Action: traced(h.HandleRetireShares),
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "request-id",
+				Aliases:  []string{"req"},
+				Usage:    "request id of the resharing",
+				Required: true,
+			},
 			&cli.StringSliceFlag{
 				Name:     "operator",
 				Aliases:  []string{"o"},
@@ -125,6 +249,60 @@ func (h CliHandler) CommandResharing() *cli.Command {
 				Usage:    "validator public key value",
 				Required: true,
 			},
+			webhookURLFlag(),
+			webhookSecretFlag(),
+			p2pFlag(),
+			partialSignaturesFlag(),
+		},
+	}
+}
+
+func (h CliHandler) CommandRefresh() *cli.Command {
+	return &cli.Command{
+		Name:   "refresh",
+		Usage:  "reshare the validator key to the same operators to rotate all key shares, writes the new keyshares and deletes the superseded shares on the nodes",
+		Action: traced(h.HandleRefresh),
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "operator",
+				Aliases:  []string{"o"},
+				Usage:    "operator key-value pair",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:     "threshold",
+				Aliases:  []string{"t"},
+				Usage:    "threshold value",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "validator-pk",
+				Aliases:  []string{"vk"},
+				Usage:    "validator public key value",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "owner-address",
+				Aliases:  []string{"oa"},
+				Usage:    "The cluster owner address (in the SSV contract)",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:     "owner-nonce",
+				Aliases:  []string{"on"},
+				Usage:    "The validator registration nonce of the account (owner address) within the SSV contract (increments after each validator registration), obtained using the ssv-scanner tool.",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "network",
+				Aliases:  []string{"net"},
+				Usage:    "ETH network: prater, holesky, mainnet",
+				Required: true,
+			},
+			webhookURLFlag(),
+			webhookSecretFlag(),
+			p2pFlag(),
+			partialSignaturesFlag(),
 		},
 	}
 }
@@ -134,7 +312,7 @@ func (h CliHandler) CommandGetDKGResults() *cli.Command {
 		Name:    "get-dkg-results",
 		Aliases: []string{"gr"},
 		Usage:   "get validator-pk and key shares data for all operators",
-		Action:  h.HandleGetData,
+		Action:  traced(h.HandleGetData),
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "request-id",
@@ -151,7 +329,7 @@ func (h CliHandler) CommandGetKeyshares() *cli.Command {
 		Name:    "get-keyshares",
 		Aliases: []string{"gks"},
 		Usage:   "generates a keyshare for registering the validator on ssv UI",
-		Action:  h.HandleGetKeyShares,
+		Action:  traced(h.HandleGetKeyShares),
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "request-id",
@@ -183,6 +361,272 @@ func (h CliHandler) CommandGetKeyshares() *cli.Command {
 				Usage:    "ETH network: prater, holesky, mainnet",
 				Required: true,
 			},
+			p2pFlag(),
+			partialSignaturesFlag(),
+		},
+	}
+}
+
+func (h CliHandler) CommandVoluntaryExit() *cli.Command {
+	return &cli.Command{
+		Name:    "voluntary-exit",
+		Aliases: []string{"ve"},
+		Usage:   "threshold sign a voluntary exit and write the SignedVoluntaryExit json for the beacon api",
+		Action:  traced(h.HandleVoluntaryExit),
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "operator",
+				Aliases:  []string{"o"},
+				Usage:    "operator key-value pair",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "validator-pk",
+				Aliases: []string{"vk"},
+				Usage:   "validator public key value",
+			},
+			&cli.Uint64Flag{
+				Name:    "validator-index",
+				Aliases: []string{"vi"},
+				Usage:   "beacon chain index of the validator",
+			},
+			&cli.StringFlag{
+				Name:  "batch-file",
+				Usage: "json list of {\"validator_pk\", \"validator_index\"} of validators of the same operators to pre-sign exits for, instead of --validator-pk and --validator-index",
+			},
+			&cli.Uint64Flag{
+				Name:  "epoch",
+				Usage: "earliest epoch the exit is valid at",
+			},
+			&cli.StringFlag{
+				Name:     "network",
+				Aliases:  []string{"net"},
+				Usage:    "ETH network: prater, holesky, mainnet",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "directory the signed exits are written to",
+				Value: ".",
+			},
+			p2pFlag(),
+			partialSignaturesFlag(),
+		},
+	}
+}
+
+func (h CliHandler) CommandBuilderRegistration() *cli.Command {
+	return &cli.Command{
+		Name:    "builder-registration",
+		Aliases: []string{"br"},
+		Usage:   "threshold sign mev-boost validator registrations and write the SignedValidatorRegistrationV1 json",
+		Action:  traced(h.HandleBuilderRegistration),
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "operator",
+				Aliases:  []string{"o"},
+				Usage:    "operator key-value pair",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:    "validator-pk",
+				Aliases: []string{"vk"},
+				Usage:   "validator public key, can be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "batch-file",
+				Usage: "json list of {\"validator_pk\", \"fee_recipient\", \"gas_limit\"} of validators of the same operators to register, fee_recipient and gas_limit are optional",
+			},
+			&cli.StringFlag{
+				Name:    "fee-recipient",
+				Aliases: []string{"fr"},
+				Usage:   "execution address receiving the fees of the validators",
+			},
+			&cli.Uint64Flag{
+				Name:  "gas-limit",
+				Usage: "gas limit of the blocks the validators propose",
+				Value: DefaultGasLimit,
+			},
+			&cli.Int64Flag{
+				Name:  "timestamp",
+				Usage: "unix timestamp of the registrations (default: now)",
+			},
+			&cli.StringFlag{
+				Name:     "network",
+				Aliases:  []string{"net"},
+				Usage:    "ETH network: prater, holesky, mainnet",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "directory the signed registrations are written to",
+				Value: ".",
+			},
+			p2pFlag(),
+			partialSignaturesFlag(),
+		},
+	}
+}
+
+func (h CliHandler) CommandReconstructKey() *cli.Command {
+	return &cli.Command{
+		Name:  "reconstruct-key",
+		Usage: "offline, interpolate the validator key from a threshold of exported key shares and write it as an EIP-2335 keystore",
+		// not traced, nothing may leave the machine
+		Action: h.HandleReconstructKey,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "share",
+				Aliases:  []string{"s"},
+				Usage:    "operatorID=path of the EIP-2335 keystore of the key share of the operator, can be repeated",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "share-password-file",
+				Usage:    "operatorID=path of the file with the password of the operator's share keystore, repeated for every share",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "dkg-result",
+				Usage:    "dkg result json written by get-dkg-results, the shares are checked against its share public keys",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "password-file",
+				Usage:    "file with the password to encrypt the validator keystore with",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "directory the validator keystore is written to",
+				Value: ".",
+			},
+			&cli.BoolFlag{
+				Name:  "accept-risks",
+				Usage: "confirm that the validator isn't run by the operators anymore, a key running twice is slashed",
+			},
+		},
+	}
+}
+
+func (h CliHandler) CommandSplitKey() *cli.Command {
+	return &cli.Command{
+		Name:  "split-key",
+		Usage: "split the key of an existing validator into shares of the operators and write the dkg result and keyshares for ssv",
+		// not traced, the validator key is in memory
+		Action: h.HandleSplitKey,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "keystore",
+				Usage:    "EIP-2335 keystore of the validator key",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "password-file",
+				Usage:    "file with the password of the keystore",
+				Required: true,
+			},
+			&cli.IntSliceFlag{
+				Name:     "operator-id",
+				Aliases:  []string{"oid"},
+				Usage:    "ID of an operator in the operator registry, can be repeated",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:     "threshold",
+				Aliases:  []string{"t"},
+				Usage:    "threshold value",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "owner-address",
+				Aliases:  []string{"oa"},
+				Usage:    "The cluster owner address (in the SSV contract)",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:     "owner-nonce",
+				Aliases:  []string{"on"},
+				Usage:    "The validator registration nonce of the account (owner address) within the SSV contract (increments after each validator registration), obtained using the ssv-scanner tool.",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "network",
+				Aliases:  []string{"net"},
+				Usage:    "ETH network: prater, holesky, mainnet",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "directory the dkg result and keyshares are written to",
+				Value: ".",
+			},
+		},
+	}
+}
+
+func (h CliHandler) CommandGenerateRegisterTx() *cli.Command {
+	return &cli.Command{
+		Name:   "generate-register-tx",
+		Usage:  "encode the ssv network contract call registering the validators of keyshares files, written as unsigned transactions and a safe transaction builder batch",
+		Action: h.HandleGenerateRegisterTx,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "keyshares",
+				Aliases:  []string{"ks"},
+				Usage:    "keyshares file of a validator, several validators of the same owner and operators are registered with bulkRegisterValidator",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "contract",
+				Usage:    "address of the SSV network contract",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "network",
+				Aliases:  []string{"net"},
+				Usage:    "ETH network: prater, holesky, mainnet",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "amount",
+				Usage: "amount of SSV in wei deposited to the cluster",
+				Value: "0",
+			},
+			&cli.StringFlag{
+				Name:  "ssv-token",
+				Usage: "address of the SSV token, when set the approval of the amount for the contract is added before the registration",
+			},
+			&cli.StringFlag{
+				Name:  "cluster-file",
+				Usage: "JSON file with the cluster snapshot obtained using the ssv-scanner tool",
+			},
+			&cli.UintFlag{
+				Name:  "validator-count",
+				Usage: "validatorCount of the cluster snapshot",
+			},
+			&cli.Uint64Flag{
+				Name:  "network-fee-index",
+				Usage: "networkFeeIndex of the cluster snapshot",
+			},
+			&cli.Uint64Flag{
+				Name:  "index",
+				Usage: "index of the cluster snapshot",
+			},
+			&cli.BoolFlag{
+				Name:  "active",
+				Usage: "active of the cluster snapshot",
+				Value: true,
+			},
+			&cli.StringFlag{
+				Name:  "balance",
+				Usage: "balance of the cluster snapshot in wei",
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "directory the transactions are written to",
+				Value: ".",
+			},
 		},
 	}
 }
@@ -192,7 +636,7 @@ func (h CliHandler) CommandGenerateDepositData() *cli.Command {
 		Name:    "generate-deposit-data",
 		Aliases: []string{"gdd"},
 		Usage:   "generate deposit data in json format",
-		Action:  h.HandleGetDepositData,
+		Action:  traced(h.HandleGetDepositData),
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "request-id",
@@ -220,7 +664,7 @@ func (h *CliHandler) DKGResultByRequestID(requestID string) (*DKGResult, error)
 	log := h.logger.WithFields(logrus.Fields{"request-id": requestID})
 	log.Debug("DKGResultByRequestID: fetching dkg results for keygen/resharing")
 
-	resp, err := h.client.Get(fmt.Sprintf("%s/data/%s", h.messengerAddr, requestID))
+	resp, err := h.client.Get(fmt.Sprintf("%s/data/%s", h.resultsAddr, requestID))
 	if err != nil {
 		log.Errorf("failed to request messenger server for dkg result: %s", err.Error())
 		return nil, fmt.Errorf("DKGResultByRequestID: failed to request messenger server for dkg result %s", err.Error())
@@ -244,6 +688,50 @@ func (h *CliHandler) DKGResultByRequestID(requestID string) (*DKGResult, error)
 	return formatResults(data), nil
 }
 
+// traced runs the command in a root span. Requests of the command carry it
+// through c.Context.
+func traced(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		ctx, span := tracing.Tracer().Start(c.Context, "cli."+c.Command.Name)
+		c.Context = ctx
+		err := action(c)
+		tracing.EndWithError(span, err)
+		return err
+	}
+}
+
+// post sends data to a node or the messenger with the trace context of ctx
+func (h *CliHandler) post(ctx context.Context, url string, data []byte) (*http.Response, error) {
+	return h.send(ctx, http.MethodPost, url, data)
+}
+
+// send requests a node or the messenger with the trace context of ctx
+func (h *CliHandler) send(ctx context.Context, method, url string, data []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	tracing.Inject(ctx, req.Header)
+	return h.client.Do(req)
+}
+
+// consumeError extracts the reason a node gave for not consuming a message,
+// e.g. a rejection by its ceremony policy
+func consumeError(resp *http.Response) string {
+	body := struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}{}
+	respBody, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(respBody, &body); err != nil || body.Error == "" {
+		return resp.Status
+	}
+	return fmt.Sprintf("%s: %s", resp.Status, body.Error)
+}
+
 func getRandRequestID() dkg.RequestID {
 	requestID := dkg.RequestID{}
 	for i := range requestID {
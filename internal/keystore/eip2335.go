@@ -0,0 +1,90 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+)
+
+// EIP2335 is a BLS12-381 key encrypted in the keystore format of EIP-2335, as
+// used by validator clients and the staking deposit cli
+type EIP2335 struct {
+	Crypto      map[string]any `json:"crypto"`
+	Description string         `json:"description"`
+	PubKey      string         `json:"pubkey"`
+	Path        string         `json:"path"`
+	UUID        string         `json:"uuid"`
+	Version     uint           `json:"version"`
+}
+
+// NewEIP2335 encrypts the secret key with the password. DKG keys aren't
+// derived from a mnemonic, so the keystore has no derivation path.
+func NewEIP2335(secret, pubKey []byte, password, description string) (*EIP2335, error) {
+	encryptor := keystorev4.New()
+	crypto, err := encryptor.Encrypt(secret, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %w", err)
+	}
+	return &EIP2335{
+		Crypto:      crypto,
+		Description: description,
+		PubKey:      hex.EncodeToString(pubKey),
+		UUID:        uuid.New().String(),
+		Version:     encryptor.Version(),
+	}, nil
+}
+
+func ReadEIP2335FromFile(filepath string) (*EIP2335, error) {
+	filedata, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	k := &EIP2335{}
+	if err := json.Unmarshal(filedata, k); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore %s: %w", filepath, err)
+	}
+	if k.Version != keystorev4.New().Version() {
+		return nil, fmt.Errorf("unsupported version %d of keystore %s", k.Version, filepath)
+	}
+	return k, nil
+}
+
+// Decrypt returns the secret key of the keystore
+func (k *EIP2335) Decrypt(password string) ([]byte, error) {
+	secret, err := keystorev4.New().Decrypt(k.Crypto, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore of %s: %w", k.PubKey, err)
+	}
+	return secret, nil
+}
+
+// PubKeyBytes returns the public key the keystore is labelled with
+func (k *EIP2335) PubKeyBytes() ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(k.PubKey, "0x"))
+}
@@ -25,47 +25,234 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rifflock/lfshook"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+const (
+	EnvLevel      = "DKG_LOG_LEVEL"
+	EnvFormat     = "DKG_LOG_FORMAT"
+	EnvOutput     = "DKG_LOG_OUTPUT"
+	EnvPath       = "DKG_LOG_PATH"
+	EnvMaxSize    = "DKG_LOG_MAX_SIZE_MB"
+	EnvMaxAge     = "DKG_LOG_MAX_AGE_DAYS"
+	EnvMaxBackups = "DKG_LOG_MAX_BACKUPS"
+	EnvSyslogAddr = "DKG_LOG_SYSLOG_ADDR"
+)
+
+const (
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// fields shared by the services so that the logs of a ceremony can be
+// filtered across the cli, the messenger and the nodes
+const (
+	ServiceField    = "service"
+	RequestIDField  = "request_id"
+	OperatorIDField = "operator_id"
+)
+
+type Config struct {
+	Level   logrus.Level
+	Format  string
+	Outputs []string
+
+	// Dir is where the log file, rockx_dkg_<service>.log, is written. It's
+	// rotated once it reaches MaxSizeMB, rotated files are removed after
+	// MaxAgeDays or when there are more than MaxBackups of them.
+	Dir        string
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+
+	// SyslogAddr is the remote syslog server as network://host:port, the
+	// local syslog daemon is used if it's empty
+	SyslogAddr string
+}
+
+func DefaultConfig(serviceName string) *Config {
+	cfg := &Config{
+		Level:      logrus.DebugLevel,
+		Format:     FormatText,
+		Outputs:    []string{OutputStdout, OutputFile},
+		Dir:        ".",
+		MaxSizeMB:  100,
+		MaxAgeDays: 28,
+		MaxBackups: 5,
+	}
+	// the cli prints its results to stdout and only logs to the file
+	if serviceName == "cli" {
+		cfg.Outputs = []string{OutputFile}
+	}
+	return cfg
+}
+
+func ConfigFromEnv(serviceName string) (*Config, error) {
+	cfg := DefaultConfig(serviceName)
+
+	switch level := os.Getenv(EnvLevel); level {
+	case "":
+	case "release":
+		cfg.Level = logrus.InfoLevel
+	default:
+		parsed, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", EnvLevel, err)
+		}
+		cfg.Level = parsed
+		if serviceName == "cli" && parsed >= logrus.DebugLevel {
+			cfg.Outputs = []string{OutputStdout, OutputFile}
+		}
+	}
+
+	if format := os.Getenv(EnvFormat); format != "" {
+		if format != FormatText && format != FormatJSON {
+			return nil, fmt.Errorf("invalid %s %s, use %s or %s", EnvFormat, format, FormatText, FormatJSON)
+		}
+		cfg.Format = format
+	}
+
+	if outputs := os.Getenv(EnvOutput); outputs != "" {
+		cfg.Outputs = make([]string, 0)
+		for _, output := range strings.Split(outputs, ",") {
+			output = strings.TrimSpace(output)
+			switch output {
+			case OutputStdout, OutputFile, OutputSyslog:
+				cfg.Outputs = append(cfg.Outputs, output)
+			case "":
+			default:
+				return nil, fmt.Errorf("invalid %s %s, use %s, %s or %s", EnvOutput, output, OutputStdout, OutputFile, OutputSyslog)
+			}
+		}
+	}
+
+	if dir := os.Getenv(EnvPath); dir != "" {
+		cfg.Dir = dir
+	}
+	for env, value := range map[string]*int{
+		EnvMaxSize:    &cfg.MaxSizeMB,
+		EnvMaxAge:     &cfg.MaxAgeDays,
+		EnvMaxBackups: &cfg.MaxBackups,
+	} {
+		if os.Getenv(env) == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(os.Getenv(env))
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid %s %s", env, os.Getenv(env))
+		}
+		*value = parsed
+	}
+	cfg.SyslogAddr = os.Getenv(EnvSyslogAddr)
+	return cfg, nil
+}
+
+// New creates the logger of the service from the DKG_LOG_* env vars. An invalid
+// config is reported in the log and replaced by the default one.
 func New(serviceName string) *logrus.Logger {
+	cfg, err := ConfigFromEnv(serviceName)
+	if err != nil {
+		logger, _ := NewWithConfig(serviceName, DefaultConfig(serviceName))
+		logger.Errorf("invalid log config, using the defaults: %v", err)
+		return logger
+	}
 
-	basePath := "."
-	if os.Getenv("DKG_LOG_PATH") != "" {
-		basePath = os.Getenv("DKG_LOG_PATH")
+	logger, err := NewWithConfig(serviceName, cfg)
+	if err != nil {
+		logger.Errorf("failed to set up log outputs: %v", err)
 	}
-	logFilePath := fmt.Sprintf("%s/rockx_dkg_%s.log", basePath, serviceName)
+	return logger
+}
 
+// NewWithConfig always returns a usable logger, outputs that failed to be set
+// up are skipped and reported in the error
+func NewWithConfig(serviceName string, cfg *Config) (*logrus.Logger, error) {
 	logger := logrus.New()
-
-	if os.Getenv("DKG_LOG_LEVEL") == "release" {
-		logger.SetLevel(logrus.InfoLevel)
+	logger.SetLevel(cfg.Level)
+	if cfg.Format == FormatJSON {
+		logger.SetFormatter(&logrus.JSONFormatter{})
 	} else {
-		logger.SetLevel(logrus.DebugLevel)
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
 	}
+	AddFields(logger, logrus.Fields{ServiceField: serviceName})
 
-	fileHook := lfshook.NewHook(lfshook.PathMap{
-		logrus.InfoLevel:  logFilePath,
-		logrus.WarnLevel:  logFilePath,
-		logrus.ErrorLevel: logFilePath,
-		logrus.DebugLevel: logFilePath,
-	}, &logrus.JSONFormatter{})
-
-	logger.AddHook(fileHook)
+	var (
+		writers = make([]io.Writer, 0)
+		errs    = make([]string, 0)
+		logFile string
+	)
+	for _, output := range cfg.Outputs {
+		switch output {
+		case OutputStdout:
+			writers = append(writers, os.Stdout)
+		case OutputFile:
+			logFile = filepath.Join(cfg.Dir, fmt.Sprintf("rockx_dkg_%s.log", serviceName))
+			writers = append(writers, &lumberjack.Logger{
+				Filename:   logFile,
+				MaxSize:    cfg.MaxSizeMB,
+				MaxAge:     cfg.MaxAgeDays,
+				MaxBackups: cfg.MaxBackups,
+			})
+		case OutputSyslog:
+			hook, err := newSyslogHook(cfg.SyslogAddr, "rockx-dkg-"+serviceName)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			logger.AddHook(hook)
+		}
+	}
 
-	if serviceName == "cli" && os.Getenv("DKG_LOG_LEVEL") != "debug" {
+	switch len(writers) {
+	case 0:
 		logger.SetOutput(io.Discard)
-	} else {
-		logger.AddHook(fileHook)
-		logger.SetOutput(os.Stdout)
+	case 1:
+		logger.SetOutput(writers[0])
+	default:
+		logger.SetOutput(io.MultiWriter(writers...))
 	}
 
-	logger.Infof("writing logs to: %s", logFilePath)
-	return logger
+	if logFile != "" {
+		logger.Infof("writing logs to: %s", logFile)
+	}
+	if len(errs) > 0 {
+		return logger, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return logger, nil
+}
+
+// fieldsHook adds fields to every entry that doesn't set them itself
+type fieldsHook struct {
+	fields logrus.Fields
+}
+
+func (h *fieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fieldsHook) Fire(entry *logrus.Entry) error {
+	for key, value := range h.fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
+
+// AddFields adds fields to every entry of the logger, e.g. the operator ID of a node
+func AddFields(logger *logrus.Logger, fields logrus.Fields) {
+	logger.AddHook(&fieldsHook{fields: fields})
 }
 
 func GinLogger(logger *logrus.Logger) gin.HandlerFunc {
@@ -74,6 +261,13 @@ func GinLogger(logger *logrus.Logger) gin.HandlerFunc {
 		path := c.Request.URL.Path
 		raw := c.Request.URL.RawQuery
 
+		// handlers log through the request scoped logger
+		log := logrus.NewEntry(logger)
+		if requestID := requestIDFromGin(c); requestID != "" {
+			log = ForRequest(logger, requestID)
+		}
+		c.Request = c.Request.WithContext(WithContext(c.Request.Context(), log))
+
 		// Process request
 		c.Next()
 
@@ -85,7 +279,7 @@ func GinLogger(logger *logrus.Logger) gin.HandlerFunc {
 		statusCode := c.Writer.Status()
 		errorMessage := c.Errors.ByType(gin.ErrorTypePrivate).String()
 
-		entry := logger.WithFields(logrus.Fields{
+		entry := log.WithFields(logrus.Fields{
 			"status_code": statusCode,
 			"latency":     latency,
 			"client_ip":   clientIP,
@@ -105,3 +299,15 @@ func GinLogger(logger *logrus.Logger) gin.HandlerFunc {
 		}
 	}
 }
+
+// requestIDFromGin finds the request ID of the ceremony in the route or query.
+// Ceremony topics of the messenger are named by the request ID.
+func requestIDFromGin(c *gin.Context) string {
+	if requestID := c.Param("request_id"); requestID != "" {
+		return requestID
+	}
+	if requestID := c.Query("request_id"); requestID != "" {
+		return requestID
+	}
+	return c.Query("topic_name")
+}
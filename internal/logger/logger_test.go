@@ -0,0 +1,75 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvLevel, "release")
+	cfg, err := ConfigFromEnv("node")
+	require.NoError(t, err)
+	require.Equal(t, logrus.InfoLevel, cfg.Level)
+	require.Equal(t, []string{OutputStdout, OutputFile}, cfg.Outputs)
+
+	// the cli only logs to stdout when debugging
+	cfg, err = ConfigFromEnv("cli")
+	require.NoError(t, err)
+	require.Equal(t, []string{OutputFile}, cfg.Outputs)
+	t.Setenv(EnvLevel, "debug")
+	cfg, err = ConfigFromEnv("cli")
+	require.NoError(t, err)
+	require.Equal(t, []string{OutputStdout, OutputFile}, cfg.Outputs)
+
+	t.Setenv(EnvOutput, "stdout, syslog")
+	t.Setenv(EnvMaxSize, "10")
+	cfg, err = ConfigFromEnv("messenger")
+	require.NoError(t, err)
+	require.Equal(t, []string{OutputStdout, OutputSyslog}, cfg.Outputs)
+	require.Equal(t, 10, cfg.MaxSizeMB)
+
+	t.Setenv(EnvFormat, "xml")
+	_, err = ConfigFromEnv("messenger")
+	require.Error(t, err)
+}
+
+func TestRequestScopedFields(t *testing.T) {
+	log, err := NewWithConfig("node", &Config{Level: logrus.InfoLevel, Format: FormatJSON})
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	AddFields(log, logrus.Fields{OperatorIDField: 1})
+
+	ForRequest(log, "0102").Info("processed")
+
+	entry := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	require.Equal(t, "node", entry[ServiceField])
+	require.Equal(t, "0102", entry[RequestIDField])
+	require.Equal(t, float64(1), entry[OperatorIDField])
+}
@@ -0,0 +1,49 @@
+//go:build !windows && !plan9
+
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package logger
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	logrussyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+func newSyslogHook(addr, tag string) (logrus.Hook, error) {
+	network, raddr := "", ""
+	if addr != "" {
+		parts := strings.SplitN(addr, "://", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid syslog address %s, expected network://host:port", addr)
+		}
+		network, raddr = parts[0], parts[1]
+	}
+	hook, err := logrussyslog.NewSyslogHook(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return hook, nil
+}
@@ -23,7 +23,6 @@ package messenger
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -32,6 +31,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 )
@@ -43,7 +44,7 @@ type Client struct {
 
 func NewMessengerClient(srvAddr string) *Client {
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: tlsconfig.MustClientConfigFromEnv(),
 	}
 
 	if srvAddr == "" {
@@ -107,29 +108,13 @@ func (cl *Client) RegisterOperatorNode(id, addr string) error {
 
 	errors := make([]error, 0)
 	for ; try <= numtries; try++ {
-		sub := &Subscriber{
-			Name:    id,
-			SrvAddr: addr,
-		}
-		byts, _ := json.Marshal(sub)
-
-		url := fmt.Sprintf("%s/register_node?subscribes_to=%s", cl.SrvAddr, DefaultTopic)
-		resp, err := cl.client.Post(url, "application/json", bytes.NewReader(byts))
-		if err != nil {
-			err := fmt.Errorf("failed to make request to messenger: %s", err.Error())
-			log.Printf("Error: %s\n", err.Error())
-			errors = append(errors, err)
-			continue
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			err := fmt.Errorf("failed to register operator of ID %s with the messenger on %d try: %s", sub.Name, try, err.Error())
-			log.Printf("Error: %s\n", err.Error())
-			errors = append(errors, err)
-		} else {
+		err := cl.RegisterOperatorNodeOnce(id, addr)
+		if err == nil {
 			break
 		}
+		err = fmt.Errorf("failed to register operator of ID %s with the messenger on %d try: %w", id, try, err)
+		log.Printf("Error: %s\n", err.Error())
+		errors = append(errors, err)
 	}
 
 	if try > numtries {
@@ -138,8 +123,54 @@ func (cl *Client) RegisterOperatorNode(id, addr string) error {
 	return nil
 }
 
+func (cl *Client) RegisterOperatorNodeOnce(id, addr string) error {
+	sub := &Subscriber{
+		Name:    id,
+		SrvAddr: addr,
+	}
+	byts, _ := json.Marshal(sub)
+
+	url := fmt.Sprintf("%s/register_node?subscribes_to=%s", cl.SrvAddr, DefaultTopic)
+	resp, err := cl.client.Post(url, "application/json", bytes.NewReader(byts))
+	if err != nil {
+		return fmt.Errorf("failed to make request to messenger: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("messenger rejected registration: %s", responseError(resp))
+	}
+	return nil
+}
+
+// Heartbeat tells the messenger this node is still alive. It returns
+// ErrNodeNotRegistered if the messenger doesn't know this node anymore, e.g.
+// after the messenger restarted.
+func (cl *Client) Heartbeat(id, addr string) error {
+	sub := &Subscriber{
+		Name:    id,
+		SrvAddr: addr,
+	}
+	byts, _ := json.Marshal(sub)
+
+	resp, err := cl.client.Post(fmt.Sprintf("%s/heartbeat", cl.SrvAddr), "application/json", bytes.NewReader(byts))
+	if err != nil {
+		return fmt.Errorf("failed to make request to messenger: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrNodeNotRegistered
+	default:
+		return fmt.Errorf("messenger rejected heartbeat: %s", responseError(resp))
+	}
+}
+
 func (cl *Client) publish(topicName string, data []byte) error {
-	resp, err := cl.client.Post(fmt.Sprintf("%s/publish?topic_name=%s", cl.SrvAddr, topicName), "application/json", bytes.NewBuffer(data))
+	resp, err := cl.postCeremony(topicName, fmt.Sprintf("%s/publish?topic_name=%s", cl.SrvAddr, topicName), data)
 	if err != nil {
 		return err
 	}
@@ -151,8 +182,23 @@ func (cl *Client) publish(topicName string, data []byte) error {
 	return nil
 }
 
+// Record adds a message that was sent to the nodes directly, like an init
+// message, to the transcript of the topic if the messenger is recording
+func (cl *Client) Record(topicName string, data []byte) error {
+	resp, err := cl.postCeremony(topicName, fmt.Sprintf("%s/record?topic_name=%s", cl.SrvAddr, topicName), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to record message: %s", responseError(resp))
+	}
+	return nil
+}
+
 func (cl *Client) stream(urlparam string, requestID string, data []byte) error {
-	resp, err := cl.client.Post(fmt.Sprintf("%s/stream/%s?request_id=%s", cl.SrvAddr, urlparam, requestID), "application/json", bytes.NewBuffer(data))
+	resp, err := cl.postCeremony(requestID, fmt.Sprintf("%s/stream/%s?request_id=%s", cl.SrvAddr, urlparam, requestID), data)
 	if err != nil {
 		return err
 	}
@@ -164,28 +210,62 @@ func (cl *Client) stream(urlparam string, requestID string, data []byte) error {
 	return nil
 }
 
+// postCeremony posts a request of the ceremony, carrying its trace context
+func (cl *Client) postCeremony(requestID, url string, data []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(tracing.CeremonyContext(requestID), req.Header)
+	return cl.client.Do(req)
+}
+
 func (cl *Client) CreateTopic(requestID string, l []types.OperatorID) error {
+	return cl.CreateTopicWithWebhook(requestID, l, nil)
+}
+
+// CreateTopicWithWebhook creates the topic for a ceremony and asks the messenger
+// to notify the given webhook once the ceremony output or blame is stored
+func (cl *Client) CreateTopicWithWebhook(requestID string, l []types.OperatorID, webhook *Webhook) error {
 	topic := TopicJSON{
 		TopicName:   requestID,
 		Subscribers: make([]string, 0),
 	}
+	if webhook != nil {
+		topic.WebhookURL = webhook.URL
+		topic.WebhookSecret = webhook.Secret
+	}
 	for _, operatorID := range l {
 		topic.Subscribers = append(topic.Subscribers, strconv.Itoa(int(operatorID)))
 	}
 	data, _ := json.Marshal(topic)
 
-	resp, err := cl.client.Post(fmt.Sprintf("%s/topics", cl.SrvAddr), "application/json", bytes.NewBuffer(data))
+	resp, err := cl.postCeremony(requestID, fmt.Sprintf("%s/topics", cl.SrvAddr), data)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to call createTopic on messenger")
+		return fmt.Errorf("failed to call createTopic on messenger: %s", responseError(resp))
 	}
 	return nil
 }
 
+// responseError extracts the error reported by the messenger in its response body
+func responseError(resp *http.Response) string {
+	body := struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}{}
+	respBody, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(respBody, &body); err != nil || body.Error == "" {
+		return resp.Status
+	}
+	return body.Error
+}
+
 func (cl *Client) GetTopic(topicName string) (*Topic, error) {
 	resp, err := cl.client.Get(fmt.Sprintf("%s/topics/%s", cl.SrvAddr, topicName))
 	if err != nil {
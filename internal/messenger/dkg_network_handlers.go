@@ -27,6 +27,8 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/metrics"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/gin-gonic/gin"
@@ -46,7 +48,7 @@ func (m *Messenger) HandlePublish() func(*gin.Context) {
 			return
 		}
 
-		err = m.Publish(topicName, data)
+		err = m.Publish(c.Request.Context(), topicName, data)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"message": fmt.Sprintf("failed to publish data to topic %s", topicName),
@@ -62,20 +64,55 @@ func (m *Messenger) HandlePublish() func(*gin.Context) {
 	}
 }
 
+// HandleRecord adds a message to the transcript of a topic without relaying it.
+// It is a no-op if the messenger isn't recording.
+func (m *Messenger) HandleRecord() func(*gin.Context) {
+
+	return func(c *gin.Context) {
+		topicName := c.Query("topic_name")
+
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to load data from request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := m.Record(topicName, data); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("failed to record data for topic %s", topicName),
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, nil)
+	}
+}
+
 func (m *Messenger) HandleGetData() func(*gin.Context) {
 
 	return func(c *gin.Context) {
 		requestID := c.Param("request_id")
 
-		_, ok := m.Data[requestID]
+		data, ok := m.Result(requestID)
 		if !ok {
 			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
-		c.JSON(http.StatusOK, m.Data[requestID])
+		c.JSON(http.StatusOK, data)
 	}
 }
 
+// Result returns the dkg output or blame streamed by the nodes for the request
+func (m *Messenger) Result(requestID string) (*DataStore, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.Data[requestID]
+	return data, ok
+}
+
 func (m *Messenger) HandleStreamDKGOutput() func(*gin.Context) {
 
 	return func(c *gin.Context) {
@@ -91,7 +128,17 @@ func (m *Messenger) HandleStreamDKGOutput() func(*gin.Context) {
 			return
 		}
 
-		m.Data[requestID] = &DataStore{DKGOutputs: data}
+		dataStore := &DataStore{DKGOutputs: data}
+		m.mu.Lock()
+		if old, exist := m.Data[requestID]; exist {
+			dataStore.Rejections = old.Rejections
+		}
+		m.Data[requestID] = dataStore
+		m.mu.Unlock()
+		logger.FromContext(c.Request.Context(), m.logger).Infof("HandleStreamDKGOutput: stored output of %d operators", len(data))
+
+		m.ceremonyFinished(requestID, metrics.ResultOutput)
+		m.notify(WebhookEventDKGOutput, requestID, dataStore)
 		c.JSON(http.StatusOK, nil)
 	}
 }
@@ -111,7 +158,17 @@ func (m *Messenger) HandleStreamDKGBlame() func(*gin.Context) {
 			return
 		}
 
-		m.Data[requestID] = &DataStore{BlameOutput: data}
+		dataStore := &DataStore{BlameOutput: data}
+		m.mu.Lock()
+		if old, exist := m.Data[requestID]; exist {
+			dataStore.Rejections = old.Rejections
+		}
+		m.Data[requestID] = dataStore
+		m.mu.Unlock()
+		logger.FromContext(c.Request.Context(), m.logger).Warnf("HandleStreamDKGBlame: stored blame, valid: %t", data.Valid)
+
+		m.ceremonyFinished(requestID, metrics.ResultBlame)
+		m.notify(WebhookEventDKGBlame, requestID, dataStore)
 		c.JSON(http.StatusOK, nil)
 	}
 }
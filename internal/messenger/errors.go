@@ -21,7 +21,16 @@
 
 package messenger
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNodeNotRegistered = errors.New("node is not registered with the messenger")
+	ErrShuttingDown      = errors.New("messenger is shutting down")
+)
 
 type ErrTopicNotFound struct {
 	TopicName string
@@ -30,3 +39,30 @@ type ErrTopicNotFound struct {
 func (err *ErrTopicNotFound) Error() string {
 	return fmt.Sprintf("topic with name %s not found\n", err.TopicName)
 }
+
+type ErrSubscribersUnavailable struct {
+	Unregistered []string
+	Unhealthy    []string
+}
+
+func (err *ErrSubscribersUnavailable) Error() string {
+	reasons := make([]string, 0)
+	if len(err.Unregistered) > 0 {
+		reasons = append(reasons, fmt.Sprintf("operators not registered with the messenger: [%s]", strings.Join(err.Unregistered, ", ")))
+	}
+	if len(err.Unhealthy) > 0 {
+		reasons = append(reasons, fmt.Sprintf("operators not reachable by the messenger: [%s]", strings.Join(err.Unhealthy, ", ")))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// ErrDeliveryRejected is returned when a node refuses a message for good, e.g.
+// because its policy doesn't allow the ceremony, so retrying is pointless
+type ErrDeliveryRejected struct {
+	Status string
+	Body   string
+}
+
+func (err *ErrDeliveryRejected) Error() string {
+	return fmt.Sprintf("subscriber rejected the message with status %s: %s", err.Status, err.Body)
+}
@@ -0,0 +1,266 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	DefaultHealthCheckInterval = 15 * time.Second
+	DefaultSubscriberTimeout   = time.Minute
+)
+
+type SubscriberStatus struct {
+	Name     string    `json:"name"`
+	SrvAddr  string    `json:"srv_addr"`
+	Healthy  bool      `json:"healthy"`
+	Version  string    `json:"version,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+	// LastHeartbeat is when the node last called the messenger. It doesn't
+	// make the node healthy, only the messenger reaching the node does.
+	LastHeartbeat time.Time `json:"last_heartbeat,omitempty"`
+	LastChecked   time.Time `json:"last_checked,omitempty"`
+	LatencyMs     int64     `json:"latency_ms"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// HealthChecker periodically pings every registered node. A subscriber is
+// considered healthy while its last health check passed and the messenger
+// reached it within the subscriber timeout. A (re-)registration counts as
+// reached until the next check, heartbeats don't count since they only show
+// that the node reaches the messenger.
+type HealthChecker struct {
+	client   *http.Client
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.RWMutex
+	statuses map[string]*SubscriberStatus
+
+	logger *logrus.Logger
+}
+
+func NewHealthChecker(logger *logrus.Logger, interval, timeout time.Duration) *HealthChecker {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	return &HealthChecker{
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsconfig.MustClientConfigFromEnv()},
+		},
+		interval: interval,
+		timeout:  timeout,
+		statuses: make(map[string]*SubscriberStatus),
+		logger:   logger,
+	}
+}
+
+// Track starts monitoring the subscriber when it (re-)registers. A new
+// subscriber, or one at a new address, is considered reachable until it is
+// checked.
+func (hc *HealthChecker) Track(name, srvAddr string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	status, ok := hc.statuses[name]
+	if ok && status.SrvAddr == srvAddr {
+		return
+	}
+	if !ok {
+		status = &SubscriberStatus{Name: name}
+		hc.statuses[name] = status
+	}
+	status.SrvAddr = srvAddr
+	status.LastSeen = time.Now()
+	status.Error = ""
+}
+
+// Heartbeat records a heartbeat of the subscriber
+func (hc *HealthChecker) Heartbeat(name string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if status, ok := hc.statuses[name]; ok {
+		status.LastHeartbeat = time.Now()
+	}
+}
+
+// IsHealthy always returns true when the subscriber timeout is disabled
+func (hc *HealthChecker) IsHealthy(name string) bool {
+	if hc.timeout <= 0 {
+		return true
+	}
+
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	status, ok := hc.statuses[name]
+	if !ok {
+		return false
+	}
+	return hc.healthy(status)
+}
+
+// healthy requires hc.mu to be held
+func (hc *HealthChecker) healthy(status *SubscriberStatus) bool {
+	if hc.timeout <= 0 {
+		return true
+	}
+	return status.Error == "" && time.Since(status.LastSeen) <= hc.timeout
+}
+
+func (hc *HealthChecker) Statuses() []SubscriberStatus {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	statuses := make([]SubscriberStatus, 0, len(hc.statuses))
+	for _, status := range hc.statuses {
+		s := *status
+		s.Healthy = hc.healthy(status)
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+func (hc *HealthChecker) HealthCheckWorker(ctx context.Context) error {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			hc.checkAll()
+		}
+	}
+}
+
+func (hc *HealthChecker) checkAll() {
+	hc.mu.RLock()
+	targets := make(map[string]string, len(hc.statuses))
+	for name, status := range hc.statuses {
+		targets[name] = status.SrvAddr
+	}
+	hc.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, addr := range targets {
+		wg.Add(1)
+		go func(name, addr string) {
+			defer wg.Done()
+			hc.check(name, addr)
+		}(name, addr)
+	}
+	wg.Wait()
+}
+
+func (hc *HealthChecker) check(name, addr string) {
+	start := time.Now()
+	err := hc.ping(addr)
+	latency := time.Since(start)
+
+	var version string
+	if err == nil {
+		version, err = hc.version(addr)
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	status, ok := hc.statuses[name]
+	if !ok || status.SrvAddr != addr {
+		// subscriber re-registered with a different address while we were checking
+		return
+	}
+	status.LastChecked = time.Now()
+	if err != nil {
+		status.Error = err.Error()
+		hc.logger.Warnf("HealthChecker: subscriber %s at %s failed health check: %v", name, addr, err)
+		return
+	}
+	status.Error = ""
+	status.LastSeen = status.LastChecked
+	status.LatencyMs = latency.Milliseconds()
+	status.Version = version
+}
+
+func (hc *HealthChecker) ping(addr string) error {
+	resp, err := hc.client.Get(fmt.Sprintf("%s/ping", strings.TrimSuffix(addr, "/")))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping responded with status %s", resp.Status)
+	}
+	return nil
+}
+
+func (hc *HealthChecker) version(addr string) (string, error) {
+	resp, err := hc.client.Get(fmt.Sprintf("%s/version", strings.TrimSuffix(addr, "/")))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("version responded with status %s", resp.Status)
+	}
+
+	body := struct {
+		Version string `json:"version"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse version response: %w", err)
+	}
+	return body.Version, nil
+}
+
+func (m *Messenger) HandleGetSubscribers() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if m.Health == nil {
+			c.JSON(http.StatusOK, []SubscriberStatus{})
+			return
+		}
+		c.JSON(http.StatusOK, m.Health.Statuses())
+	}
+}
@@ -24,35 +24,91 @@ package messenger
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/metrics"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/transcript"
 	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/dkg/frost"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	DefaultTopic = "default"
 )
 
+const (
+	topicQueueSize      = 256
+	subscriberQueueSize = 256
+	maxRetriesAllowed   = 10
+	retryDelay          = 2 * time.Second
+	deliveryTimeout     = 30 * time.Second
+	drainPollInterval   = 100 * time.Millisecond
+
+	DefaultShutdownGracePeriod = 30 * time.Second
+)
+
+// Messenger relays protocol messages between DKG nodes. Every topic has its own
+// dispatch worker and every subscriber of a topic its own delivery worker, so a
+// slow node only delays the ceremonies it takes part in while messages within
+// a topic are still delivered to each subscriber in the order they were published.
 type Messenger struct {
+	mu     sync.RWMutex
 	Topics map[string]*Topic
 	Data   map[string]*DataStore
 
-	Incoming chan *Message
+	Webhooks *WebhookNotifier
+	Health   *HealthChecker
 
+	// RecordDir enables recording every message published to a ceremony topic
+	// into an append-only transcript in this directory
+	RecordDir string
+
+	// closing refuses new topics while the messenger shuts down, pending
+	// counts the messages queued for dispatch or delivery
+	closing atomic.Bool
+	pending atomic.Int64
+
+	client *http.Client
+	runner *workers.Runner
 	logger *logrus.Logger
 }
 
+func New(logger *logrus.Logger, runner *workers.Runner) *Messenger {
+	m := &Messenger{
+		Topics: make(map[string]*Topic),
+		Data:   make(map[string]*DataStore),
+		client: &http.Client{
+			Timeout: deliveryTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig:     tlsconfig.MustClientConfigFromEnv(),
+				MaxIdleConnsPerHost: 100,
+				IdleConnTimeout:     5 * time.Minute,
+			},
+		},
+		runner: runner,
+		logger: logger,
+	}
+	m.addTopic(newTopic(DefaultTopic))
+	return m
+}
+
 func (m *Messenger) WithLogger(logger *logrus.Logger) {
 	m.logger = logger
 }
@@ -60,143 +116,439 @@ func (m *Messenger) WithLogger(logger *logrus.Logger) {
 type Topic struct {
 	Name        string
 	Subscribers map[string]*Subscriber
+	Webhook     *Webhook `json:",omitempty"`
+
+	incoming chan *Message
+	done     chan struct{}
+	recorder *transcript.Writer
+	// created and finished time the ceremony for the metrics
+	created  time.Time
+	finished time.Time
+}
+
+func newTopic(name string) *Topic {
+	return &Topic{
+		Name:        name,
+		Subscribers: make(map[string]*Subscriber),
+		incoming:    make(chan *Message, topicQueueSize),
+		done:        make(chan struct{}),
+		created:     time.Now(),
+	}
 }
 
 type Subscriber struct {
 	Name         string            `json:"name"`
 	SrvAddr      string            `json:"srv_addr"`
 	SubscribesTo map[string]*Topic `json:"-"`
-	Outgoing     chan *Message     `json:"-"`
-	RetryData    map[string]int    `json:"-"`
 }
 
 type Message struct {
 	Topic string
 	Data  []byte
+
+	// ctx carries the trace context of the publisher to the deliveries
+	ctx context.Context
 }
 
 type DataStore struct {
 	DKGOutputs  map[types.OperatorID]*dkg.SignedOutput
 	BlameOutput *dkg.BlameOutput
+	// Rejections holds the reason of every subscriber that refused a message
+	// of the ceremony, by subscriber name
+	Rejections map[string]string `json:",omitempty"`
 }
 
-func (m *Messenger) Publish(topicName string, data []byte) error {
+// addTopic registers the topic, replacing any topic with the same name, and
+// starts its dispatch worker. Callers must hold m.mu.
+func (m *Messenger) addTopic(tp *Topic) {
+	if old, exist := m.Topics[tp.Name]; exist {
+		m.removeTopic(old)
+	}
+	m.Topics[tp.Name] = tp
+
+	if m.RecordDir != "" && tp.Name != DefaultTopic {
+		recorder, err := transcript.NewWriter(m.RecordDir, tp.Name)
+		if err != nil {
+			logger.ForRequest(m.logger, tp.Name).Errorf("addTopic: failed to create transcript for topic %s: %v", tp.Name, err)
+		} else {
+			tp.recorder = recorder
+		}
+	}
+
+	m.runner.AddJob(&workers.Job{
+		ID: fmt.Sprintf("TOPIC__%s", tp.Name),
+		Fn: m.topicDispatchWorker(tp),
+	})
+}
+
+// removeTopic stops the dispatch and delivery workers of the topic and forgets
+// its webhook notifications. Callers must hold m.mu.
+func (m *Messenger) removeTopic(tp *Topic) {
+	for _, subscriber := range tp.Subscribers {
+		if subscriber.SubscribesTo[tp.Name] == tp {
+			delete(subscriber.SubscribesTo, tp.Name)
+		}
+	}
+	if m.Topics[tp.Name] == tp {
+		delete(m.Topics, tp.Name)
+	}
+	if m.Webhooks != nil {
+		m.Webhooks.Forget(tp.Name)
+	}
+	close(tp.done)
+}
+
+func (m *Messenger) notify(event, requestID string, data *DataStore) {
+	if m.Webhooks == nil {
+		return
+	}
+	m.mu.RLock()
+	tp, exist := m.Topics[requestID]
+	m.mu.RUnlock()
+	if !exist {
+		return
+	}
+	m.Webhooks.Notify(tp.Webhook, event, requestID, data)
+}
+
+// ceremonyFinished observes the duration of the ceremony once, when the first
+// node streams its output or blame
+func (m *Messenger) ceremonyFinished(requestID, result string) {
+	m.mu.Lock()
+	tp, exist := m.Topics[requestID]
+	first := exist && tp.finished.IsZero()
+	if first {
+		tp.finished = time.Now()
+	}
+	m.mu.Unlock()
+
+	if first {
+		metrics.MessengerCeremonies.WithLabelValues(result).Observe(tp.finished.Sub(tp.created).Seconds())
+	}
+}
+
+// Publish queues the message for the subscribers of the topic. The trace
+// context of ctx is passed on to the deliveries.
+func (m *Messenger) Publish(ctx context.Context, topicName string, data []byte) error {
+	m.mu.RLock()
 	tp, exist := m.Topics[topicName]
+	m.mu.RUnlock()
 	if !exist {
-		m.logger.Errorf("Publish: topic %s already exists", topicName)
+		logger.ForRequest(m.logger, topicName).Errorf("Publish: topic %s doesn't exist", topicName)
 		return &ErrTopicNotFound{TopicName: topicName}
 	}
 
-	m.Incoming <- &Message{Topic: tp.Name, Data: data}
-	return nil
+	m.pending.Add(1)
+	select {
+	case tp.incoming <- &Message{Topic: tp.Name, Data: data, ctx: trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))}:
+		metrics.MessagesPublished.Inc()
+		return nil
+	case <-tp.done:
+		m.pending.Add(-1)
+		return &ErrTopicNotFound{TopicName: topicName}
+	}
 }
 
-func (m *Messenger) ProcessIncomingMessageWorker(ctx *context.Context) {
-	for msg := range m.Incoming {
-		tp, exist := m.Topics[msg.Topic]
-		if !exist {
-			var err = &ErrTopicNotFound{TopicName: msg.Topic}
-			m.logger.Errorf("ProcessIncomingMessageWorker: %v", err)
-			continue
-		}
+// Drain refuses new topics and waits until every queued message is delivered
+// or dropped. Messages of running ceremonies are still accepted meanwhile.
+func (m *Messenger) Drain(ctx context.Context) error {
+	m.closing.Store(true)
 
-		ssvMsg := &types.SSVMessage{}
-		if err := ssvMsg.Decode(msg.Data); err != nil {
-			m.logger.Errorf("ProcessIncomingMessageWorker: %v", err)
-			continue
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := m.pending.Load()
+		if pending == 0 {
+			return nil
 		}
-		signedMsg := &dkg.SignedMessage{}
-		if err := signedMsg.Decode(ssvMsg.Data); err != nil {
-			m.logger.Errorf("ProcessIncomingMessageWorker: failed to decode signed message: %v", err)
-			continue
-		}
-		protocolMsg := &frost.ProtocolMsg{}
-		if err := protocolMsg.Decode(signedMsg.Message.Data); err != nil {
-			m.logger.Errorf("ProcessIncomingMessageWorker: failed to decode protocol message: %v", err)
-			continue
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d messages are still queued: %w", pending, ctx.Err())
+		case <-ticker.C:
 		}
+	}
+}
+
+func (m *Messenger) topicDispatchWorker(tp *Topic) func(context.Context) error {
+	return func(ctx context.Context) error {
+		// delivery queues of this topic keyed by subscriber name, only
+		// accessed from this worker
+		queues := make(map[string]chan *Message)
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+			if tp.recorder != nil {
+				tp.recorder.Close()
+			}
+			// messages still queued for the topic are never dispatched
+			for {
+				select {
+				case <-tp.incoming:
+					m.pending.Add(-1)
+				default:
+					return
+				}
+			}
+		}()
 
-		m.logger.Debugf(
-			"received message from %d for msgType %d round %d",
-			signedMsg.Signer,
-			signedMsg.Message.MsgType,
-			protocolMsg.Round,
-		)
-
-		for _, subscriber := range tp.Subscribers {
-			operatorID := strconv.Itoa(int(signedMsg.Signer))
-			if operatorID == subscriber.Name {
-				continue
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-tp.done:
+				return nil
+			case msg := <-tp.incoming:
+				if !m.dispatch(tp, msg, queues) {
+					return nil
+				}
 			}
-			subscriber.Outgoing <- msg
 		}
 	}
 }
 
-const (
-	maxRetriesAllowed = 10
-)
+// dispatch fans the message out to the delivery queue of every subscriber
+// except its signer. It returns false if the topic was removed meanwhile.
+func (m *Messenger) dispatch(tp *Topic, msg *Message, queues map[string]chan *Message) bool {
+	defer m.pending.Add(-1)
+	log := logger.ForRequest(m.logger, tp.Name)
+	m.record(tp, msg, true)
+
+	signedMsg, protocolMsg, err := transcript.Decode(msg.Data)
+	if err != nil {
+		log.Errorf("topicDispatchWorker: %v", err)
+		return true
+	}
+
+	var round frost.ProtocolRound
+	if protocolMsg != nil {
+		round = protocolMsg.Round
+	}
+	log.WithFields(logrus.Fields{
+		"signer":   signedMsg.Signer,
+		"msg_type": signedMsg.Message.MsgType,
+		"round":    round,
+	}).Debugf("received message for topic %s", tp.Name)
+
+	m.mu.RLock()
+	subscribers := make([]*Subscriber, 0, len(tp.Subscribers))
+	for _, subscriber := range tp.Subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	m.mu.RUnlock()
 
-func (s *Subscriber) ProcessOutgoingMessageWorker(ctx *context.Context) {
+	operatorID := strconv.Itoa(int(signedMsg.Signer))
+	for _, subscriber := range subscribers {
+		if operatorID == subscriber.Name {
+			continue
+		}
+
+		queue, ok := queues[subscriber.Name]
+		if !ok {
+			queue = make(chan *Message, subscriberQueueSize)
+			queues[subscriber.Name] = queue
+			m.runner.AddJob(&workers.Job{
+				ID:      fmt.Sprintf("SUBSCRIBER__%s__%s", subscriber.Name, tp.Name),
+				Fn:      m.deliveryWorker(subscriber, tp, queue),
+				Restart: workers.RestartOnFailure,
+			})
+		}
+
+		m.pending.Add(1)
+		select {
+		case queue <- msg:
+		case <-tp.done:
+			m.pending.Add(-1)
+			return false
+		}
+	}
+	return true
+}
 
-	log := (*ctx).Value(workers.Ctxlog("logger"))
-	if log == nil {
-		panic("logger not found in context")
+func (m *Messenger) record(tp *Topic, msg *Message, relayed bool) {
+	if tp.recorder == nil {
+		return
+	}
+	if err := tp.recorder.Append(transcript.NewEntry(tp.Name, msg.Data, relayed)); err != nil {
+		logger.ForRequest(m.logger, tp.Name).Errorf("record: failed to append message to transcript of topic %s: %v", tp.Name, err)
 	}
-	logger := log.(*logrus.Logger)
-	logger.Infof("ProcessOutgoingMessageWorker: logger loaded successfully")
+}
 
-	for msg := range s.Outgoing {
+// Record adds a message to the transcript of the topic without relaying it.
+// The CLI uses it for init messages, which are sent to the nodes directly.
+func (m *Messenger) Record(topicName string, data []byte) error {
+	m.mu.RLock()
+	tp, exist := m.Topics[topicName]
+	m.mu.RUnlock()
+	if !exist {
+		return &ErrTopicNotFound{TopicName: topicName}
+	}
 
-		h := sha256.Sum256(msg.Data)
-		k := base64.RawStdEncoding.EncodeToString(h[:])
+	m.record(tp, &Message{Topic: topicName, Data: data}, false)
+	return nil
+}
 
-		numRetries, ok := s.RetryData[k]
-		if ok {
-			if numRetries >= maxRetriesAllowed {
-				continue
-			} else {
-				s.RetryData[k]++
+// deliveryWorker delivers the queued messages until the queue is closed. A
+// restarted worker continues with the next message of the queue.
+func (m *Messenger) deliveryWorker(s *Subscriber, tp *Topic, queue chan *Message) func(context.Context) error {
+	return func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				m.dropQueued(s, tp, queue)
+				return nil
+			case msg, ok := <-queue:
+				if !ok {
+					return nil
+				}
+				m.deliver(ctx, s, tp, msg)
 			}
-		} else {
-			s.RetryData[k] = 0
 		}
+	}
+}
 
-		if numRetries > 0 {
-			time.Sleep(2 * (time.Second))
+// dropQueued drops the messages left in the queue of a cancelled delivery worker
+func (m *Messenger) dropQueued(s *Subscriber, tp *Topic, queue chan *Message) {
+	dropped := 0
+loop:
+	for {
+		select {
+		case _, ok := <-queue:
+			if !ok {
+				break loop
+			}
+			dropped++
+			m.pending.Add(-1)
+			metrics.MessagesDropped.WithLabelValues(s.Name).Inc()
+		default:
+			break loop
 		}
+	}
+	if dropped > 0 {
+		logger.ForRequest(m.logger, tp.Name).Warnf("deliveryWorker: dropped %d messages for topic %s to the subscriber %s", dropped, tp.Name, s.Name)
+	}
+}
 
-		_, exist := s.SubscribesTo[msg.Topic]
-		if !exist {
-			var err = &ErrTopicNotFound{TopicName: msg.Topic}
-			logger.Errorf("ProcessOutgoingMessageWorker: %v", err)
-			continue
+// deliver retries in place rather than re-queueing so that the order of
+// messages within the topic is kept
+func (m *Messenger) deliver(ctx context.Context, s *Subscriber, tp *Topic, msg *Message) {
+	defer m.pending.Add(-1)
+	traceCtx := msg.ctx
+	if traceCtx == nil {
+		traceCtx = context.Background()
+	}
+	_, span := tracing.Tracer().Start(traceCtx, "messenger.deliver", trace.WithAttributes(
+		tracing.RequestID(tp.Name),
+		attribute.String("dkg.subscriber", s.Name),
+	))
+	defer span.End()
+	ctx = trace.ContextWithSpan(ctx, span)
+	log := logger.ForRequest(m.logger, tp.Name).WithField("subscriber", s.Name)
+
+	start := time.Now()
+	for try := 1; try <= maxRetriesAllowed; try++ {
+		err := m.post(ctx, m.subscriberAddr(s), msg.Data)
+		if err == nil {
+			log.Infof("deliveryWorker: message for topic %s sent to %s successfully", tp.Name, s.Name)
+			metrics.MessagesDelivered.WithLabelValues(s.Name).Inc()
+			metrics.DeliveryDuration.WithLabelValues(s.Name).Observe(time.Since(start).Seconds())
+			return
+		}
+		var rejected *ErrDeliveryRejected
+		if errors.As(err, &rejected) {
+			log.Errorf("deliveryWorker: subscriber %s rejected message for topic %s, not retrying: %v", s.Name, tp.Name, err)
+			metrics.MessagesDropped.WithLabelValues(s.Name).Inc()
+			span.SetStatus(codes.Error, "message rejected")
+			m.rejected(tp.Name, s.Name, rejected)
+			return
+		}
+		log.Errorf("deliveryWorker: failed to publish message for topic %s to the subscriber %s on %d try: %v", tp.Name, s.Name, try, err)
+		span.AddEvent("delivery failed", trace.WithAttributes(attribute.Int("try", try), attribute.String("error", err.Error())))
+		if try < maxRetriesAllowed {
+			metrics.DeliveryRetries.WithLabelValues(s.Name).Inc()
 		}
 
-		// TODO: replace this client
-		resp, err := http.Post(fmt.Sprintf("%s/consume", s.SrvAddr), "application/json", bytes.NewBuffer(msg.Data))
-		if err != nil {
-			logger.Errorf("ProcessOutgoingMessageWorker: %v", err)
-			continue
+		select {
+		case <-ctx.Done():
+			return
+		case <-tp.done:
+			return
+		case <-time.After(retryDelay):
 		}
+	}
+	log.Errorf("deliveryWorker: dropping message for topic %s to the subscriber %s after %d tries", tp.Name, s.Name, maxRetriesAllowed)
+	metrics.MessagesDropped.WithLabelValues(s.Name).Inc()
+	span.SetStatus(codes.Error, "message dropped")
+}
 
-		respbody, _ := io.ReadAll(resp.Body)
-		if resp.StatusCode != http.StatusOK {
-			s.Outgoing <- msg
+// isPermanent tells client errors of a node, like a policy rejection, from
+// timeouts and rate limits, which are worth retrying
+func isPermanent(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+}
 
-			err := fmt.Errorf("failed to publish message to the subscriber %s %v", s.Name, string(respbody))
-			logger.Errorf("ProcessOutgoingMessageWorker: %v", err)
-		} else {
-			logger.Infof("ProcessOutgoingMessageWorker: message sent to %s successfully", s.Name)
+// rejected records the rejection in the result of the ceremony and notifies
+// the webhook, since the ceremony can't finish without the subscriber. The
+// result is replaced rather than modified as it may be read meanwhile.
+func (m *Messenger) rejected(requestID, subscriber string, err *ErrDeliveryRejected) {
+	m.mu.Lock()
+	data := &DataStore{}
+	if old, exist := m.Data[requestID]; exist {
+		if _, seen := old.Rejections[subscriber]; seen {
+			m.mu.Unlock()
+			return
 		}
-		resp.Body.Close()
+		*data = *old
+	}
+	rejections := make(map[string]string, len(data.Rejections)+1)
+	for name, reason := range data.Rejections {
+		rejections[name] = reason
 	}
+	rejections[subscriber] = err.Error()
+	data.Rejections = rejections
+	m.Data[requestID] = data
+	m.mu.Unlock()
+
+	m.notify(WebhookEventDeliveryRejected, requestID, data)
+}
+
+func (m *Messenger) subscriberAddr(s *Subscriber) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return s.SrvAddr
 }
 
+func (m *Messenger) post(ctx context.Context, addr string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/consume", addr), bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respbody, _ := io.ReadAll(resp.Body)
+	if isPermanent(resp.StatusCode) {
+		return &ErrDeliveryRejected{Status: resp.Status, Body: string(respbody)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("subscriber responded with status %s: %s", resp.Status, string(respbody))
+	}
+	return nil
+}
+
+const DefaultMessengerAddr = "https://dkg-messenger.rockx.com"
+
 func MessengerAddrFromEnv() string {
 	if os.Getenv("MESSENGER_SRV_ADDR") != "" {
 		return os.Getenv("MESSENGER_SRV_ADDR")
 	} else {
-		return "https://dkg-messenger.rockx.com"
+		return DefaultMessengerAddr
 	}
 }
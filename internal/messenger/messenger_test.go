@@ -0,0 +1,432 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// testNode records the rounds of the messages it received by topic. The
+// handler runs off the test goroutine, so decoding errors are recorded as well
+// and asserted by the test.
+type testNode struct {
+	mu       sync.Mutex
+	received map[string][]int
+	errs     []error
+}
+
+func (n *testNode) handler(blockTopic string, release chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+
+		signedMsg, protocolMsg, err := decodeTestMessage(data)
+		if err != nil {
+			n.mu.Lock()
+			n.errs = append(n.errs, err)
+			n.mu.Unlock()
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		topic := hex.EncodeToString(signedMsg.Message.Identifier[:])
+		if topic == blockTopic {
+			<-release
+		}
+
+		n.mu.Lock()
+		n.received[topic] = append(n.received[topic], int(protocolMsg.Round))
+		n.mu.Unlock()
+	}
+}
+
+func decodeTestMessage(data []byte) (*dkg.SignedMessage, *frost.ProtocolMsg, error) {
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(data); err != nil {
+		return nil, nil, err
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil {
+		return nil, nil, err
+	}
+	protocolMsg := &frost.ProtocolMsg{}
+	if err := protocolMsg.Decode(signedMsg.Message.Data); err != nil {
+		return nil, nil, err
+	}
+	return signedMsg, protocolMsg, nil
+}
+
+func (n *testNode) errors() []error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.errs
+}
+
+func (n *testNode) count(topic string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.received[topic])
+}
+
+func testMessage(t *testing.T, requestID dkg.RequestID, signer types.OperatorID, seq int) []byte {
+	protocolMsg := &frost.ProtocolMsg{Round: frost.ProtocolRound(seq)}
+	protocolMsgBytes, err := protocolMsg.Encode()
+	require.NoError(t, err)
+
+	signedMsg := &dkg.SignedMessage{
+		Message: &dkg.Message{
+			MsgType:    dkg.ProtocolMsgType,
+			Identifier: requestID,
+			Data:       protocolMsgBytes,
+		},
+		Signer: signer,
+	}
+	signedMsgBytes, err := signedMsg.Encode()
+	require.NoError(t, err)
+
+	ssvMsg := &types.SSVMessage{MsgType: types.DKGMsgType, Data: signedMsgBytes}
+	data, err := ssvMsg.Encode()
+	require.NoError(t, err)
+	return data
+}
+
+// TestParallelCeremonies runs 100 ceremonies at once while one node hangs on
+// the first ceremony. Every other ceremony must still be fully delivered, in order.
+func TestParallelCeremonies(t *testing.T) {
+	const (
+		numNodes    = 7
+		numTopics   = 100
+		numMessages = 5
+		slowNode    = numNodes
+	)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	runner := workers.NewRunner(logger)
+	go runner.Run()
+
+	m := New(logger, runner)
+
+	requestIDs := make([]dkg.RequestID, numTopics)
+	topicNames := make([]string, numTopics)
+	for i := range requestIDs {
+		copy(requestIDs[i][:], fmt.Sprintf("ceremony-%d", i))
+		topicNames[i] = hex.EncodeToString(requestIDs[i][:])
+	}
+
+	release := make(chan struct{})
+	nodes := make(map[int]*testNode)
+	for id := 1; id <= numNodes; id++ {
+		node := &testNode{received: make(map[string][]int)}
+		nodes[id] = node
+
+		blockTopic := ""
+		if id == slowNode {
+			blockTopic = topicNames[0]
+		}
+		srv := httptest.NewServer(node.handler(blockTopic, release))
+		defer srv.Close()
+
+		name := strconv.Itoa(id)
+		m.Topics[DefaultTopic].Subscribers[name] = &Subscriber{
+			Name:         name,
+			SrvAddr:      srv.URL,
+			SubscribesTo: map[string]*Topic{DefaultTopic: m.Topics[DefaultTopic]},
+		}
+	}
+	// unblock the slow node before the servers are closed
+	defer close(release)
+
+	m.mu.Lock()
+	for _, name := range topicNames {
+		tp := newTopic(name)
+		for _, subscriber := range m.Topics[DefaultTopic].Subscribers {
+			subscriber.SubscribesTo[name] = tp
+			tp.Subscribers[subscriber.Name] = subscriber
+		}
+		m.addTopic(tp)
+	}
+	m.mu.Unlock()
+
+	messages := make([][][]byte, numTopics)
+	for i := range topicNames {
+		signer := types.OperatorID(i%(numNodes-1) + 1)
+		for seq := 1; seq <= numMessages; seq++ {
+			messages[i] = append(messages[i], testMessage(t, requestIDs[i], signer, seq))
+		}
+	}
+
+	// the publishers run off the test goroutine and only report their errors
+	publishErrs := make(chan error, numTopics*numMessages)
+	var wg sync.WaitGroup
+	for i := range topicNames {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, data := range messages[i] {
+				if err := m.Publish(context.Background(), topicNames[i], data); err != nil {
+					publishErrs <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(publishErrs)
+	for err := range publishErrs {
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		for i, name := range topicNames {
+			signer := i%(numNodes-1) + 1
+			for id, node := range nodes {
+				if id == signer || (i == 0 && id == slowNode) {
+					continue
+				}
+				if node.count(name) != numMessages {
+					return false
+				}
+			}
+		}
+		return true
+	}, 10*time.Second, 50*time.Millisecond)
+
+	for i, name := range topicNames {
+		signer := i%(numNodes-1) + 1
+		for id, node := range nodes {
+			if id == signer || (i == 0 && id == slowNode) {
+				continue
+			}
+			node.mu.Lock()
+			require.Equal(t, []int{1, 2, 3, 4, 5}, node.received[name], "topic %d node %d", i, id)
+			node.mu.Unlock()
+		}
+	}
+	for id, node := range nodes {
+		require.Empty(t, node.errors(), "node %d", id)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	runner := workers.NewRunner(logger)
+	go runner.Run()
+	m := New(logger, runner)
+
+	var requestID dkg.RequestID
+	copy(requestID[:], "drain")
+	topicName := hex.EncodeToString(requestID[:])
+
+	release := make(chan struct{})
+	node := &testNode{received: make(map[string][]int)}
+	srv := httptest.NewServer(node.handler(topicName, release))
+	defer srv.Close()
+
+	m.mu.Lock()
+	tp := newTopic(topicName)
+	tp.Subscribers["2"] = &Subscriber{Name: "2", SrvAddr: srv.URL, SubscribesTo: map[string]*Topic{topicName: tp}}
+	m.addTopic(tp)
+	m.mu.Unlock()
+
+	require.NoError(t, m.Publish(context.Background(), topicName, testMessage(t, requestID, 1, 1)))
+
+	// the node blocks the delivery until it is released
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, m.Drain(ctx), context.DeadlineExceeded)
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, m.Drain(ctx))
+	require.Equal(t, 1, node.count(topicName))
+	require.Empty(t, node.errors())
+
+	require.NoError(t, runner.Shutdown(ctx))
+}
+
+func TestDeliveryRejected(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	runner := workers.NewRunner(logger)
+	go runner.Run()
+	m := New(logger, runner)
+
+	var requestID dkg.RequestID
+	copy(requestID[:], "rejected")
+	topicName := hex.EncodeToString(requestID[:])
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"dkg node refused to join the ceremony"}`))
+	}))
+	defer srv.Close()
+
+	m.mu.Lock()
+	tp := newTopic(topicName)
+	tp.Subscribers["2"] = &Subscriber{Name: "2", SrvAddr: srv.URL, SubscribesTo: map[string]*Topic{topicName: tp}}
+	m.addTopic(tp)
+	m.mu.Unlock()
+
+	require.NoError(t, m.Publish(context.Background(), topicName, testMessage(t, requestID, 1, 1)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), retryDelay)
+	defer cancel()
+	require.NoError(t, m.Drain(ctx))
+	require.Equal(t, int32(1), calls.Load())
+
+	data, ok := m.Result(topicName)
+	require.True(t, ok)
+	require.Contains(t, data.Rejections["2"], "403")
+
+	require.NoError(t, runner.Shutdown(ctx))
+}
+
+// TestHeartbeatDoesNotMakeHealthy covers a node that reaches the messenger but
+// that the messenger can't reach: its heartbeats must not keep it healthy
+func TestHeartbeatDoesNotMakeHealthy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	m := New(logger, workers.NewRunner(logger))
+	m.Health = NewHealthChecker(logger, time.Hour, time.Minute)
+
+	var reachable atomic.Bool
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reachable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"version":"v1"}`))
+	}))
+	defer node.Close()
+
+	r := gin.New()
+	m.RegisterRoutes(r, false)
+	heartbeat := func() int {
+		body := fmt.Sprintf(`{"name":"1","srv_addr":%q}`, node.URL)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/heartbeat", strings.NewReader(body)))
+		return w.Code
+	}
+
+	require.NoError(t, m.Register(&Subscriber{Name: "1", SrvAddr: node.URL}, DefaultTopic))
+	require.True(t, m.Health.IsHealthy("1"))
+
+	m.Health.checkAll()
+	require.False(t, m.Health.IsHealthy("1"))
+	require.Equal(t, http.StatusOK, heartbeat())
+	require.False(t, m.Health.IsHealthy("1"))
+
+	statuses := m.Health.Statuses()
+	require.Len(t, statuses, 1)
+	require.False(t, statuses[0].Healthy)
+	require.False(t, statuses[0].LastHeartbeat.IsZero())
+
+	reachable.Store(true)
+	m.Health.checkAll()
+	require.True(t, m.Health.IsHealthy("1"))
+}
+
+// TestUnavailableSubscribers covers a topic whose subscribers are unregistered
+// or failed their health check
+func TestUnavailableSubscribers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	m := New(logger, workers.NewRunner(logger))
+	m.Health = NewHealthChecker(logger, time.Hour, time.Minute)
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"v1"}`))
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	require.NoError(t, m.Register(&Subscriber{Name: "1", SrvAddr: up.URL}, DefaultTopic))
+	require.NoError(t, m.Register(&Subscriber{Name: "2", SrvAddr: down.URL}, DefaultTopic))
+	m.Health.checkAll()
+	require.True(t, m.Health.IsHealthy("1"))
+	require.False(t, m.Health.IsHealthy("2"))
+
+	r := gin.New()
+	m.RegisterRoutes(r, false)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/subscribers", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var statuses []SubscriberStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &statuses))
+	require.Len(t, statuses, 2)
+	require.Equal(t, "1", statuses[0].Name)
+	require.True(t, statuses[0].Healthy)
+	require.Equal(t, "v1", statuses[0].Version)
+	require.Equal(t, "2", statuses[1].Name)
+	require.False(t, statuses[1].Healthy)
+	require.NotEmpty(t, statuses[1].Error)
+
+	topicName := hex.EncodeToString(make([]byte, len(dkg.RequestID{})))
+	w = serve(http.MethodPost, "/topics", fmt.Sprintf(`{"topic_name":%q,"subscribers":["1","2","3"]}`, topicName))
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+	var unavailable struct {
+		Unregistered []string `json:"unregistered"`
+		Unhealthy    []string `json:"unhealthy"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &unavailable))
+	require.Equal(t, []string{"3"}, unavailable.Unregistered)
+	require.Equal(t, []string{"2"}, unavailable.Unhealthy)
+
+	w = serve(http.MethodPost, "/topics", fmt.Sprintf(`{"topic_name":%q,"subscribers":["1"]}`, topicName))
+	require.Equal(t, http.StatusOK, w.Code)
+}
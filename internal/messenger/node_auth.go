@@ -0,0 +1,65 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireNodeCertificate rejects requests that don't present a client certificate
+// verified against the messenger's client CA. It guards the routes used by the
+// nodes when the messenger runs with mTLS, while the cli only needs server TLS.
+func RequireNodeCertificate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := certOperator(c); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "a verified operator certificate is required",
+				"error":   "missing client certificate",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// certOperator returns the common name of the verified client certificate,
+// which for operator certificates is the operator ID
+func certOperator(c *gin.Context) (string, bool) {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(c.Request.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return c.Request.TLS.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// checkOperatorCert makes sure a node can only register as the operator its
+// certificate was issued to. Requests without a certificate pass, mTLS is
+// enforced by RequireNodeCertificate.
+func checkOperatorCert(c *gin.Context, operatorID string) error {
+	cn, ok := certOperator(c)
+	if !ok || cn == operatorID {
+		return nil
+	}
+	return fmt.Errorf("certificate of operator %s can't be used for operator %s", cn, operatorID)
+}
@@ -25,31 +25,17 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
 	"github.com/gin-gonic/gin"
 )
 
-func (m *Messenger) HandleNodeRegistration(runner *workers.Runner) func(*gin.Context) {
+func (m *Messenger) HandleNodeRegistration() func(*gin.Context) {
 
 	return func(c *gin.Context) {
 
 		subscribesTo := c.Query("subscribes_to")
 
-		_, exist := m.Topics[subscribesTo]
-		if !exist {
-			err := &ErrTopicNotFound{TopicName: subscribesTo}
-			m.logger.Errorf("HandleNodeRegistration: %v", err)
-			c.JSON(http.StatusNotFound, gin.H{
-				"message": fmt.Sprintf("topic %s doesn't exist", subscribesTo),
-				"error":   err.Error(),
-			})
-			return
-		}
-
 		subscriber := &Subscriber{
 			SubscribesTo: map[string]*Topic{},
-			Outgoing:     make(chan *Message, 50),
-			RetryData:    make(map[string]int),
 		}
 
 		if err := c.ShouldBindJSON(subscriber); err != nil {
@@ -71,20 +57,107 @@ func (m *Messenger) HandleNodeRegistration(runner *workers.Runner) func(*gin.Con
 			return
 		}
 
-		existingSubscriber, ok := m.Topics[subscribesTo].Subscribers[subscriber.Name]
-		if ok {
-			existingSubscriber.SrvAddr = subscriber.SrvAddr
-			m.Topics[subscribesTo].Subscribers[subscriber.Name] = existingSubscriber
-		} else {
-			subscriber.Outgoing = make(chan *Message, 50)
-			subscriber.RetryData = make(map[string]int)
-			subscriber.SubscribesTo[subscribesTo] = m.Topics[subscribesTo]
-			m.Topics[subscribesTo].Subscribers[subscriber.Name] = subscriber
-
-			runner.AddJob(&workers.Job{
-				ID: fmt.Sprintf("SUBSCRIBER__%s", subscriber.Name),
-				Fn: m.Topics[subscribesTo].Subscribers[subscriber.Name].ProcessOutgoingMessageWorker,
+		if err := checkOperatorCert(c, subscriber.Name); err != nil {
+			m.logger.Errorf("HandleNodeRegistration: %v", err)
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "operator certificate doesn't match the subscriber",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := m.Register(subscriber, subscribesTo); err != nil {
+			m.logger.Errorf("HandleNodeRegistration: %v", err)
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("topic %s doesn't exist", subscribesTo),
+				"error":   err.Error(),
 			})
+			return
+		}
+		c.JSON(http.StatusOK, nil)
+	}
+}
+
+// Register subscribes the node to the topic or updates its address if it's
+// already subscribed
+func (m *Messenger) Register(subscriber *Subscriber, topicName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	topic, exist := m.Topics[topicName]
+	if !exist {
+		return &ErrTopicNotFound{TopicName: topicName}
+	}
+
+	if m.Health != nil {
+		m.Health.Track(subscriber.Name, subscriber.SrvAddr)
+	}
+
+	existingSubscriber, ok := topic.Subscribers[subscriber.Name]
+	if ok {
+		existingSubscriber.SrvAddr = subscriber.SrvAddr
+	} else {
+		if subscriber.SubscribesTo == nil {
+			subscriber.SubscribesTo = map[string]*Topic{}
+		}
+		subscriber.SubscribesTo[topicName] = topic
+		topic.Subscribers[subscriber.Name] = subscriber
+	}
+	return nil
+}
+
+// Unregistered returns the subscribers of the list that haven't registered yet
+func (m *Messenger) Unregistered(names []string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	unregistered := make([]string, 0)
+	for _, name := range names {
+		if _, ok := m.Topics[DefaultTopic].Subscribers[name]; !ok {
+			unregistered = append(unregistered, name)
+		}
+	}
+	return unregistered
+}
+
+func (m *Messenger) HandleNodeHeartbeat() func(*gin.Context) {
+
+	return func(c *gin.Context) {
+		subscriber := &Subscriber{}
+		if err := c.ShouldBindJSON(subscriber); err != nil {
+			m.logger.Errorf("HandleNodeHeartbeat: failed to parse subscriber from request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to parse subscriber data from the request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := checkOperatorCert(c, subscriber.Name); err != nil {
+			m.logger.Errorf("HandleNodeHeartbeat: %v", err)
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "operator certificate doesn't match the subscriber",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		m.mu.RLock()
+		existingSubscriber, ok := m.Topics[DefaultTopic].Subscribers[subscriber.Name]
+		known := ok && existingSubscriber.SrvAddr == subscriber.SrvAddr
+		m.mu.RUnlock()
+
+		if !known {
+			m.logger.Warnf("HandleNodeHeartbeat: heartbeat from unknown subscriber %s at %s", subscriber.Name, subscriber.SrvAddr)
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("subscriber %s is not registered", subscriber.Name),
+				"error":   ErrNodeNotRegistered.Error(),
+			})
+			return
+		}
+
+		if m.Health != nil {
+			m.Health.Heartbeat(subscriber.Name)
 		}
 		c.JSON(http.StatusOK, nil)
 	}
@@ -0,0 +1,57 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import "github.com/gin-gonic/gin"
+
+// RegisterRoutes adds the routes the nodes and the cli call to relay a ceremony.
+// If requireNodeCert is set, the routes called by the nodes and the recording of
+// init messages by the cli require a client certificate (mTLS).
+func (m *Messenger) RegisterRoutes(r gin.IRouter, requireNodeCert bool) {
+
+	// routes called by the DKG nodes
+	nodes := r.Group("")
+	if requireNodeCert {
+		nodes.Use(RequireNodeCertificate())
+	}
+
+	// Message Topic - CRUD APIs
+	topicsGroup := r.Group("/topics")
+	{
+		topicsGroup.GET("", m.GetTopics())
+		topicsGroup.POST("", m.CreateOrUpdateTopic())
+		topicsGroup.GET("/:topic_name", m.GetTopic())
+		topicsGroup.DELETE("/:topic_name", m.DeleteTopic())
+	}
+
+	// DKG Node Registration
+	nodes.POST("/register_node", m.HandleNodeRegistration())
+	nodes.POST("/heartbeat", m.HandleNodeHeartbeat())
+	r.GET("/subscribers", m.HandleGetSubscribers())
+
+	// DKG network layer actions
+	nodes.POST("/publish", m.HandlePublish())
+	nodes.POST("/record", m.HandleRecord())
+	nodes.POST("/stream/dkgoutput", m.HandleStreamDKGOutput())
+	nodes.POST("/stream/dkgblame", m.HandleStreamDKGBlame())
+	r.GET("/data/:request_id", m.HandleGetData())
+}
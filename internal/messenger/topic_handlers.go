@@ -22,18 +22,27 @@
 package messenger
 
 import (
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"net/url"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/gin-gonic/gin"
 )
 
 type TopicJSON struct {
-	TopicName   string   `json:"topic_name"`
-	Subscribers []string `json:"subscribers"`
+	TopicName     string   `json:"topic_name"`
+	Subscribers   []string `json:"subscribers"`
+	WebhookURL    string   `json:"webhook_url,omitempty"`
+	WebhookSecret string   `json:"webhook_secret,omitempty"`
 }
 
 func (m *Messenger) GetTopics() func(*gin.Context) {
 	return func(c *gin.Context) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
 		c.JSON(http.StatusOK, m.Topics)
 	}
 }
@@ -50,25 +59,105 @@ func (m *Messenger) CreateOrUpdateTopic() func(*gin.Context) {
 			return
 		}
 
-		topic := Topic{
-			Name:        topicJSON.TopicName,
-			Subscribers: make(map[string]*Subscriber),
+		if err := validTopicName(topicJSON.TopicName); err != nil {
+			m.logger.Errorf("HandleCreateTopic: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid topic name",
+				"error":   err.Error(),
+			})
+			return
 		}
 
-		for _, sub := range topicJSON.Subscribers {
-			subscriber, ok := m.Topics[DefaultTopic].Subscribers[sub]
-			if ok {
-				subscriber.SubscribesTo[topicJSON.TopicName] = &topic
-				topic.Subscribers[sub] = subscriber
+		if m.closing.Load() {
+			logger.ForRequest(m.logger, topicJSON.TopicName).Warnf("HandleCreateTopic: refusing topic %s while shutting down", topicJSON.TopicName)
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"message": "no new ceremonies are accepted",
+				"error":   ErrShuttingDown.Error(),
+			})
+			return
+		}
+
+		topic := newTopic(topicJSON.TopicName)
+
+		if topicJSON.WebhookURL != "" {
+			webhookURL, err := url.Parse(topicJSON.WebhookURL)
+			if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") {
+				m.logger.Errorf("HandleCreateTopic: invalid webhook url %s", topicJSON.WebhookURL)
+				c.JSON(http.StatusBadRequest, gin.H{
+					"message": "invalid webhook url",
+					"error":   fmt.Sprintf("webhook url %s must be an absolute http(s) url", topicJSON.WebhookURL),
+				})
+				return
 			}
+			topic.Webhook = &Webhook{
+				URL:    topicJSON.WebhookURL,
+				Secret: topicJSON.WebhookSecret,
+			}
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if err := m.checkSubscribers(topicJSON.Subscribers); err != nil {
+			logger.ForRequest(m.logger, topicJSON.TopicName).Errorf("HandleCreateTopic: topic %s can't be created: %v", topicJSON.TopicName, err)
+			c.JSON(http.StatusPreconditionFailed, gin.H{
+				"message":      fmt.Sprintf("some subscribers of topic %s are unavailable", topicJSON.TopicName),
+				"error":        err.Error(),
+				"unregistered": err.Unregistered,
+				"unhealthy":    err.Unhealthy,
+			})
+			return
 		}
-		m.Topics[topicJSON.TopicName] = &topic
+
+		for _, sub := range topicJSON.Subscribers {
+			subscriber := m.Topics[DefaultTopic].Subscribers[sub]
+			subscriber.SubscribesTo[topicJSON.TopicName] = topic
+			topic.Subscribers[sub] = subscriber
+		}
+		m.addTopic(topic)
+		logger.ForRequest(m.logger, topic.Name).Infof("HandleCreateTopic: created topic with subscribers %v", topicJSON.Subscribers)
 		c.JSON(http.StatusOK, topic)
 	}
 }
 
+// validTopicName makes sure the topic of a ceremony is named after its hex
+// encoded request ID, the name ends up in the path of its transcript
+func validTopicName(name string) error {
+	requestID, err := hex.DecodeString(name)
+	if err != nil || len(requestID) != len(dkg.RequestID{}) {
+		return fmt.Errorf("topic name %q isn't a hex encoded request id", name)
+	}
+	return nil
+}
+
+// checkSubscribers makes sure every subscriber of a new topic is registered and,
+// if health checks are enabled, reachable. Otherwise the ceremony would hang.
+// Callers must hold m.mu.
+func (m *Messenger) checkSubscribers(subscribers []string) *ErrSubscribersUnavailable {
+	err := &ErrSubscribersUnavailable{
+		Unregistered: make([]string, 0),
+		Unhealthy:    make([]string, 0),
+	}
+	for _, sub := range subscribers {
+		if _, ok := m.Topics[DefaultTopic].Subscribers[sub]; !ok {
+			err.Unregistered = append(err.Unregistered, sub)
+			continue
+		}
+		if m.Health != nil && !m.Health.IsHealthy(sub) {
+			err.Unhealthy = append(err.Unhealthy, sub)
+		}
+	}
+	if len(err.Unregistered) == 0 && len(err.Unhealthy) == 0 {
+		return nil
+	}
+	return err
+}
+
 func (m *Messenger) GetTopic() func(*gin.Context) {
 	return func(c *gin.Context) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+
 		topic, exist := m.Topics[c.Param("topic_name")]
 		if !exist {
 			c.JSON(http.StatusNotFound, nil)
@@ -80,11 +169,14 @@ func (m *Messenger) GetTopic() func(*gin.Context) {
 
 func (m *Messenger) DeleteTopic() func(*gin.Context) {
 	return func(ctx *gin.Context) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
 		topic, exist := m.Topics[ctx.Param("topic_name")]
 		if !exist {
 			ctx.JSON(http.StatusNotFound, nil)
 			return
 		}
-		delete(m.Topics, topic.Name)
+		m.removeTopic(topic)
 	}
 }
@@ -0,0 +1,218 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	WebhookEventDKGOutput = "dkg_output"
+	WebhookEventDKGBlame  = "dkg_blame"
+	// WebhookEventDeliveryRejected is sent once per request, when the first
+	// node refuses a message of the ceremony
+	WebhookEventDeliveryRejected = "delivery_rejected"
+
+	WebhookSignatureHeader = "X-DKG-Signature"
+	WebhookTimestampHeader = "X-DKG-Timestamp"
+	WebhookEventHeader     = "X-DKG-Event"
+
+	maxWebhookRetries   = 6
+	webhookInitialDelay = time.Second
+	webhookMaxDelay     = time.Minute
+
+	// webhookSentTTL bounds how long a notification is remembered for the
+	// requests whose topic is never removed
+	webhookSentTTL = 24 * time.Hour
+)
+
+// Webhook is the optional callback a topic carries. The secret is never
+// serialized so that it doesn't leak through the topics api.
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"-"`
+}
+
+type WebhookNotification struct {
+	Event     string     `json:"event"`
+	RequestID string     `json:"request_id"`
+	Timestamp int64      `json:"timestamp"`
+	Data      *DataStore `json:"data"`
+}
+
+type WebhookNotifier struct {
+	client *http.Client
+
+	// sent holds the time a notification was sent by request and event
+	mu   sync.Mutex
+	sent map[string]map[string]time.Time
+
+	logger *logrus.Logger
+}
+
+func NewWebhookNotifier(logger *logrus.Logger) *WebhookNotifier {
+	return &WebhookNotifier{
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsconfig.MustClientConfigFromEnv()},
+		},
+		sent:   make(map[string]map[string]time.Time),
+		logger: logger,
+	}
+}
+
+// Notify sends the notification in the background. Every node streams the same
+// final output set, so a notification is only sent once per request and event.
+func (n *WebhookNotifier) Notify(webhook *Webhook, event, requestID string, data *DataStore) {
+	if webhook == nil || webhook.URL == "" {
+		return
+	}
+
+	now := time.Now()
+	n.mu.Lock()
+	n.evictExpired(now)
+	if _, sent := n.sent[requestID][event]; sent {
+		n.mu.Unlock()
+		return
+	}
+	if n.sent[requestID] == nil {
+		n.sent[requestID] = make(map[string]time.Time)
+	}
+	n.sent[requestID][event] = now
+	n.mu.Unlock()
+
+	notification := &WebhookNotification{
+		Event:     event,
+		RequestID: requestID,
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	}
+	go n.deliver(webhook, notification)
+}
+
+// Forget drops the notifications sent for the request, the messenger calls it
+// once the topic of the request is removed
+func (n *WebhookNotifier) Forget(requestID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.sent, requestID)
+}
+
+// evictExpired drops the requests whose last notification is older than
+// webhookSentTTL. Callers must hold n.mu.
+func (n *WebhookNotifier) evictExpired(now time.Time) {
+	for requestID, events := range n.sent {
+		expired := true
+		for _, sentAt := range events {
+			if now.Sub(sentAt) < webhookSentTTL {
+				expired = false
+				break
+			}
+		}
+		if expired {
+			delete(n.sent, requestID)
+		}
+	}
+}
+
+func (n *WebhookNotifier) deliver(webhook *Webhook, notification *WebhookNotification) {
+	log := n.logger.WithFields(logrus.Fields{
+		"request-id": notification.RequestID,
+		"event":      notification.Event,
+	})
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		log.Errorf("WebhookNotifier: failed to marshal notification: %v", err)
+		return
+	}
+
+	delay := webhookInitialDelay
+	for try := 1; try <= maxWebhookRetries; try++ {
+		err = n.post(webhook, notification, body)
+		if err == nil {
+			log.Infof("WebhookNotifier: notification delivered to %s", webhook.URL)
+			return
+		}
+		log.Warnf("WebhookNotifier: failed to deliver notification on %d try: %v", try, err)
+
+		if try < maxWebhookRetries {
+			time.Sleep(delay)
+			delay *= 2
+			if delay > webhookMaxDelay {
+				delay = webhookMaxDelay
+			}
+		}
+	}
+	log.Errorf("WebhookNotifier: giving up on %s after %d tries", webhook.URL, maxWebhookRetries)
+}
+
+func (n *WebhookNotifier) post(webhook *Webhook, notification *WebhookNotification, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(notification.Timestamp, 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, notification.Event)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if webhook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(webhook.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhookPayload computes the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+// Receivers should recompute it with the shared secret and compare it against
+// the X-DKG-Signature header.
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
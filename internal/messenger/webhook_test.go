@@ -0,0 +1,98 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	secret := "test-secret"
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	var calls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// fail the first delivery to exercise the retry
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(logrus.New())
+	webhook := &Webhook{URL: srv.URL, Secret: secret}
+
+	n.Notify(webhook, WebhookEventDKGBlame, "abcd", &DataStore{})
+	n.Notify(webhook, WebhookEventDKGBlame, "abcd", &DataStore{})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		require.Equal(t, WebhookEventDKGBlame, r.Header.Get(WebhookEventHeader))
+
+		expected := "sha256=" + SignWebhookPayload(secret, r.Header.Get(WebhookTimestampHeader), body)
+		require.Equal(t, expected, r.Header.Get(WebhookSignatureHeader))
+
+		notification := &WebhookNotification{}
+		require.NoError(t, json.Unmarshal(body, notification))
+		require.Equal(t, "abcd", notification.RequestID)
+	case <-time.After(10 * time.Second):
+		t.Fatal("webhook notification was not delivered")
+	}
+
+	select {
+	case <-received:
+		t.Fatal("webhook notification was delivered more than once")
+	case <-time.After(2 * time.Second):
+	}
+}
+
+func TestWebhookNotifierEviction(t *testing.T) {
+	n := NewWebhookNotifier(logrus.New())
+	webhook := &Webhook{URL: "http://127.0.0.1:0"}
+
+	n.Notify(webhook, WebhookEventDKGOutput, "abcd", &DataStore{})
+	n.Notify(webhook, WebhookEventDKGOutput, "ef01", &DataStore{})
+	require.Len(t, n.sent, 2)
+
+	n.Forget("abcd")
+	require.Len(t, n.sent, 1)
+
+	n.mu.Lock()
+	n.evictExpired(time.Now().Add(webhookSentTTL))
+	n.mu.Unlock()
+	require.Empty(t, n.sent)
+}
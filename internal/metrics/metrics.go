@@ -0,0 +1,97 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ceremonies take from seconds to several minutes
+var ceremonyBuckets = []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600}
+
+// Ceremony results
+const (
+	ResultOutput = "output"
+	ResultBlame  = "blame"
+)
+
+// Messenger
+var (
+	MessagesPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dkg_messenger_messages_published_total",
+		Help: "Messages published to a ceremony topic",
+	})
+	MessagesDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dkg_messenger_messages_delivered_total",
+		Help: "Messages delivered to a subscriber",
+	}, []string{"subscriber"})
+	DeliveryRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dkg_messenger_delivery_retries_total",
+		Help: "Failed delivery attempts that are retried",
+	}, []string{"subscriber"})
+	MessagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dkg_messenger_messages_dropped_total",
+		Help: "Messages dropped after all delivery attempts to a subscriber failed",
+	}, []string{"subscriber"})
+	DeliveryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dkg_messenger_delivery_duration_seconds",
+		Help:    "Time to deliver a message to a subscriber, including retries",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"subscriber"})
+	MessengerCeremonies = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dkg_messenger_ceremony_duration_seconds",
+		Help:    "Time from the creation of a ceremony topic until its output or blame is streamed",
+		Buckets: ceremonyBuckets,
+	}, []string{"result"})
+)
+
+// Node
+var (
+	NodeCeremonies = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dkg_node_ceremony_duration_seconds",
+		Help:    "Time from the init message of a ceremony until the node streams its output or blame",
+		Buckets: ceremonyBuckets,
+	}, []string{"type", "result"})
+	ConsumeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dkg_node_consume_duration_seconds",
+		Help:    "Time the dkg node takes to process an incoming message",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"msg_type"})
+	ConsumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dkg_node_consume_errors_total",
+		Help: "Incoming messages the node failed to read, decode, join or process",
+	}, []string{"stage"})
+	PolicyRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dkg_node_policy_rejections_total",
+		Help: "Ceremonies the node refused to join because of its policy, by rule",
+	}, []string{"rule"})
+	RegistryFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "dkg_operator_registry_fetch_duration_seconds",
+		Help:    "Time to fetch an operator from the operator registry",
+		Buckets: prometheus.DefBuckets,
+	})
+	RegistryFetchFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dkg_operator_registry_fetch_failures_total",
+		Help: "Failed operator registry fetches",
+	})
+)
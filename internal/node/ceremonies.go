@@ -0,0 +1,210 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/metrics"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func msgTypeName(msgType dkg.MsgType) string {
+	switch msgType {
+	case dkg.InitMsgType:
+		return "init"
+	case dkg.ProtocolMsgType:
+		return "protocol"
+	case dkg.DepositDataMsgType:
+		return "deposit_data"
+	case dkg.OutputMsgType:
+		return "output"
+	case dkg.ReshareMsgType:
+		return "reshare"
+	case dkg.KeySignMsgType:
+		return "keysign"
+	default:
+		return "unknown"
+	}
+}
+
+// ceremonyType is the type of the ceremony a message starts, if any
+func ceremonyType(msgType dkg.MsgType) (string, bool) {
+	switch msgType {
+	case dkg.InitMsgType:
+		return "keygen", true
+	case dkg.ReshareMsgType:
+		return "reshare", true
+	case dkg.KeySignMsgType:
+		return "keysign", true
+	default:
+		return "", false
+	}
+}
+
+type ceremony struct {
+	typ     string
+	started time.Time
+	span    trace.Span
+
+	round     frost.ProtocolRound
+	roundSpan trace.Span
+}
+
+func (c *ceremony) end(result string) {
+	if c.roundSpan != nil {
+		c.roundSpan.End()
+	}
+	c.span.SetAttributes(attribute.String("dkg.result", result))
+	c.span.End()
+}
+
+// ceremonyTracker times and traces the ceremonies of the node from the init
+// message until the node streams the output or a blame
+type ceremonyTracker struct {
+	mu         sync.Mutex
+	ceremonies map[string]*ceremony
+}
+
+func newCeremonyTracker() *ceremonyTracker {
+	return &ceremonyTracker{ceremonies: make(map[string]*ceremony)}
+}
+
+// start begins a ceremony if the message is an init message. The span of the
+// ceremony continues the trace of the init request.
+func (t *ceremonyTracker) start(ctx context.Context, msg *dkg.SignedMessage) {
+	typ, ok := ceremonyType(msg.Message.MsgType)
+	if !ok {
+		return
+	}
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+	ctx, span := tracing.Tracer().Start(ctx, "dkg."+typ, trace.WithAttributes(tracing.RequestID(requestID)))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.ceremonies[requestID]; ok {
+		old.end("restarted")
+	}
+	t.ceremonies[requestID] = &ceremony{typ: typ, started: time.Now(), span: span}
+	tracing.SetCeremonyContext(requestID, ctx)
+}
+
+// round starts the span of a protocol round with its first message and ends
+// the span of the previous round
+func (t *ceremonyTracker) round(requestID string, round frost.ProtocolRound) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.ceremonies[requestID]
+	if !ok || round <= c.round {
+		return
+	}
+	if c.roundSpan != nil {
+		c.roundSpan.End()
+	}
+	ctx, span := tracing.Tracer().Start(trace.ContextWithSpan(context.Background(), c.span), fmt.Sprintf("dkg.round %d", round),
+		trace.WithAttributes(tracing.RequestID(requestID), attribute.Int("dkg.round", int(round))),
+	)
+	c.round = round
+	c.roundSpan = span
+	tracing.SetCeremonyContext(requestID, ctx)
+}
+
+func (t *ceremonyTracker) finish(requestID, result string) {
+	t.mu.Lock()
+	c, ok := t.ceremonies[requestID]
+	delete(t.ceremonies, requestID)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+	c.end(result)
+	tracing.EndCeremony(requestID)
+	metrics.NodeCeremonies.WithLabelValues(c.typ, result).Observe(time.Since(c.started).Seconds())
+}
+
+// running returns the request IDs of the ceremonies that haven't finished yet
+func (t *ceremonyTracker) running() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	requestIDs := make([]string, 0, len(t.ceremonies))
+	for requestID := range t.ceremonies {
+		requestIDs = append(requestIDs, requestID)
+	}
+	return requestIDs
+}
+
+// messageRound is the frost round of a protocol message, Uninitialized otherwise
+func messageRound(msg *dkg.SignedMessage) frost.ProtocolRound {
+	if msg.Message.MsgType != dkg.ProtocolMsgType {
+		return frost.Uninitialized
+	}
+	protocolMsg := &frost.ProtocolMsg{}
+	if err := protocolMsg.Decode(msg.Message.Data); err != nil {
+		return frost.Uninitialized
+	}
+	return protocolMsg.Round
+}
+
+// instrumentedNetwork finishes the ceremony in the tracker once the node has
+// streamed its output or blame, so that the stream still carries its trace context
+type instrumentedNetwork struct {
+	dkg.Network
+	tracker *ceremonyTracker
+}
+
+func (n *instrumentedNetwork) StreamDKGOutput(output map[types.OperatorID]*dkg.SignedOutput) error {
+	err := n.Network.StreamDKGOutput(output)
+	if requestID, ok := outputRequestID(output); ok {
+		n.tracker.finish(requestID, metrics.ResultOutput)
+	}
+	return err
+}
+
+func outputRequestID(output map[types.OperatorID]*dkg.SignedOutput) (string, bool) {
+	for _, signedOutput := range output {
+		if signedOutput.Data != nil {
+			return hex.EncodeToString(signedOutput.Data.RequestID[:]), true
+		}
+		if signedOutput.KeySignData != nil {
+			return hex.EncodeToString(signedOutput.KeySignData.RequestID[:]), true
+		}
+	}
+	return "", false
+}
+
+func (n *instrumentedNetwork) StreamDKGBlame(blame *dkg.BlameOutput) error {
+	err := n.Network.StreamDKGBlame(blame)
+	if blame.BlameMessage != nil && blame.BlameMessage.Message != nil {
+		n.tracker.finish(hex.EncodeToString(blame.BlameMessage.Message.Identifier[:]), metrics.ResultBlame)
+	}
+	return err
+}
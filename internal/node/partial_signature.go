@@ -0,0 +1,110 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/policy"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// HandlePartialSignature signs the payload of a keysign request with the key
+// share of this operator instead of running a keysign ceremony, so that the
+// cli can verify and aggregate the partial signatures itself. The request goes
+// through the same checks as a keysign ceremony.
+func (h *ApiHandler) HandlePartialSignature(node *dkg.Node, operatorID types.OperatorID) func(*gin.Context) {
+	return func(c *gin.Context) {
+		requestID := c.Query("request_id")
+		log := logger.ForRequest(h.logger, requestID)
+		if h.draining.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"message": "dkg node is shutting down",
+				"error":   ErrShuttingDown.Error(),
+			})
+			return
+		}
+
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to load data from request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		keySign, err := h.evaluate(initiatorOf(c), requestID, &dkg.Message{MsgType: dkg.KeySignMsgType, Data: data})
+		var rejection *policy.Rejection
+		if errors.As(err, &rejection) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "dkg node refused to sign the payload",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			log.Errorf("HandlePartialSignature: refused payload: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "dkg node refused to sign the payload",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		partial, err := signPartial(node, operatorID, keySign)
+		if err != nil {
+			log.Errorf("HandlePartialSignature: %v", err)
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "dkg node has no key share of the validator",
+				"error":   err.Error(),
+			})
+			return
+		}
+		log.Infof("HandlePartialSignature: signed %s payload of validator %x", keySign.Payload.Type, keySign.ValidatorPK)
+		c.JSON(http.StatusOK, partial)
+	}
+}
+
+func signPartial(node *dkg.Node, operatorID types.OperatorID, keySign *signing.KeySign) (*signing.PartialSignature, error) {
+	output, err := node.GetConfig().GetStorage().GetKeyGenOutput(keySign.ValidatorPK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key share of validator %x: %w", keySign.ValidatorPK, err)
+	}
+	if output == nil || output.Share == nil {
+		return nil, fmt.Errorf("no key share of validator %x", keySign.ValidatorPK)
+	}
+
+	return &signing.PartialSignature{
+		OperatorID:  operatorID,
+		SharePubKey: hex.EncodeToString(output.Share.GetPublicKey().Serialize()),
+		Signature:   hex.EncodeToString(output.Share.SignByte(keySign.SigningRoot).Serialize()),
+		Threshold:   output.Threshold,
+	}, nil
+}
@@ -0,0 +1,127 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	DefaultHeartbeatInterval = 15 * time.Second
+
+	minRegistrationBackoff = time.Second
+	maxRegistrationBackoff = time.Minute
+)
+
+// Registration keeps this node registered with the messenger. It registers
+// with exponential backoff, heartbeats while registered and registers again
+// whenever the messenger doesn't recognize the node anymore.
+type Registration struct {
+	client            *messenger.Client
+	operatorID        string
+	broadcastAddr     string
+	heartbeatInterval time.Duration
+
+	logger *logrus.Logger
+}
+
+func NewRegistration(client *messenger.Client, operatorID, broadcastAddr string, heartbeatInterval time.Duration, logger *logrus.Logger) *Registration {
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = DefaultHeartbeatInterval
+	}
+	return &Registration{
+		client:            client,
+		operatorID:        operatorID,
+		broadcastAddr:     broadcastAddr,
+		heartbeatInterval: heartbeatInterval,
+		logger:            logger,
+	}
+}
+
+// Run blocks until ctx is cancelled
+func (r *Registration) Run(ctx context.Context) {
+	for {
+		if !r.register(ctx) {
+			return
+		}
+		if !r.heartbeat(ctx) {
+			return
+		}
+	}
+}
+
+// register retries until the node is registered. It returns false if ctx was
+// cancelled before that.
+func (r *Registration) register(ctx context.Context) bool {
+	backoff := minRegistrationBackoff
+	for {
+		err := r.client.RegisterOperatorNodeOnce(r.operatorID, r.broadcastAddr)
+		if err == nil {
+			r.logger.Infof("Registration: operator %s registered with the messenger at %s", r.operatorID, r.client.SrvAddr)
+			return true
+		}
+		r.logger.Errorf("Registration: failed to register with the messenger, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxRegistrationBackoff {
+			backoff = maxRegistrationBackoff
+		}
+	}
+}
+
+// heartbeat returns true once the node has to register again and false if
+// ctx was cancelled
+func (r *Registration) heartbeat(ctx context.Context) bool {
+	ticker := time.NewTicker(r.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		err := r.client.Heartbeat(r.operatorID, r.broadcastAddr)
+		if errors.Is(err, messenger.ErrNodeNotRegistered) {
+			r.logger.Warnf("Registration: messenger doesn't know operator %s anymore, registering again", r.operatorID)
+			return true
+		}
+		if err != nil {
+			// the messenger is likely down, keep serving and try again on the next tick
+			r.logger.Errorf("Registration: heartbeat failed: %v", err)
+			continue
+		}
+		r.logger.Debugf("Registration: heartbeat sent")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// testMessenger fails the first registrations and forgets the node after its
+// first heartbeat, like a messenger that restarted
+type testMessenger struct {
+	mu            sync.Mutex
+	failures      int
+	registrations []time.Time
+	heartbeats    int
+}
+
+func (m *testMessenger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/register_node":
+		m.registrations = append(m.registrations, time.Now())
+		if len(m.registrations) <= m.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	case "/heartbeat":
+		m.heartbeats++
+		if m.heartbeats == 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *testMessenger) counts() (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.registrations), m.heartbeats
+}
+
+func TestRegistration(t *testing.T) {
+	minBackoff, maxBackoff := minRegistrationBackoff, maxRegistrationBackoff
+	minRegistrationBackoff, maxRegistrationBackoff = 10*time.Millisecond, 40*time.Millisecond
+	defer func() { minRegistrationBackoff, maxRegistrationBackoff = minBackoff, maxBackoff }()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	m := &testMessenger{failures: 4}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r := NewRegistration(messenger.NewMessengerClient(srv.URL), "1", "http://node:8080", 10*time.Millisecond, logger)
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+
+	// 4 failed registrations, the registration, and the registration after
+	// the messenger forgot the node on the first heartbeat
+	require.Eventually(t, func() bool {
+		registrations, heartbeats := m.counts()
+		return registrations == 6 && heartbeats >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("registration didn't stop with its context")
+	}
+
+	// the backoff between failed registrations doubles up to the maximum
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, min := range []time.Duration{10, 20, 40, 40} {
+		require.GreaterOrEqual(t, m.registrations[i+1].Sub(m.registrations[i]), min*time.Millisecond, "registration %d", i+1)
+	}
+}
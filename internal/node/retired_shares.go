@@ -0,0 +1,157 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleGetShare describes the key share the node holds of the validator, so
+// the cli can check a resharing before it starts
+func (h *ApiHandler) HandleGetShare(node *dkg.Node) func(*gin.Context) {
+	return func(c *gin.Context) {
+		vk, err := hex.DecodeString(c.Param("vk"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid validator public key",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		output, err := node.GetConfig().GetStorage().GetKeyGenOutput(vk)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "dkg node has no key share of the validator",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			h.logger.Errorf("HandleGetShare: failed to get key share of validator %x: %v", vk, err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		retired, err := h.RetiredShares.Get(vk)
+		if err != nil {
+			h.logger.Errorf("HandleGetShare: failed to get retirement of validator %x: %v", vk, err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, store.NewShareInfo(output, retired))
+	}
+}
+
+// HandleRetireShare marks the key share of the validator as retired, the node
+// refuses to sign or reshare with it from then on. Only a resharing of the
+// validator the node joined and that left this operator out retires the share,
+// once the cli confirmed the new shares of that resharing with a signature of
+// the validator key made with the new shares.
+func (h *ApiHandler) HandleRetireShare(operatorID types.OperatorID) func(*gin.Context) {
+	return func(c *gin.Context) {
+		vk, err := hex.DecodeString(c.Param("vk"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid validator public key",
+				"error":   err.Error(),
+			})
+			return
+		}
+		request := &ConfirmShareRequest{}
+		if err := c.ShouldBindJSON(request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid share confirmation",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if err := request.verifySignature(vk); err != nil {
+			h.logger.Warnf("HandleRetireShare: validator %x: %v", vk, err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid share confirmation",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		requestID := strings.ToLower(request.Confirmation.RequestID)
+		if err := h.RetiredShares.Retire(vk, requestID, operatorID, request.Confirmation.OperatorIDs()); errors.Is(err, badger.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "dkg node has no key share of the validator",
+				"error":   err.Error(),
+			})
+			return
+		} else if errors.Is(err, store.ErrRetireRefused) {
+			h.logger.Warnf("HandleRetireShare: validator %x: %v", vk, err)
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "dkg node kept the key share",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			h.logger.Errorf("HandleRetireShare: failed to retire key share of validator %x: %v", vk, err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		h.logger.Infof("HandleRetireShare: retired key share of validator %x after resharing %s", vk, requestID)
+		c.JSON(http.StatusOK, gin.H{"retired": true})
+	}
+}
+
+// HandleDeleteShare deletes the retired key share of the validator together
+// with the shares it superseded
+func (h *ApiHandler) HandleDeleteShare() func(*gin.Context) {
+	return func(c *gin.Context) {
+		vk, err := hex.DecodeString(c.Param("vk"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid validator public key",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := h.RetiredShares.Delete(vk); errors.Is(err, store.ErrShareNotRetired) {
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "dkg node kept the key share",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			h.logger.Errorf("HandleDeleteShare: failed to delete key share of validator %x: %v", vk, err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		h.logger.Infof("HandleDeleteShare: deleted retired key share of validator %x", vk)
+		c.JSON(http.StatusOK, gin.H{"deleted": true})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleRetireShare(t *testing.T) {
+	st := newShareTest(t)
+	path := "/shares/" + hex.EncodeToString(st.vk)
+	retire := func(request *ConfirmShareRequest) int {
+		data, err := json.Marshal(request)
+		require.NoError(t, err)
+		return st.serve(http.MethodPost, path+"/retire", string(data), "cli").Code
+	}
+	get := func() *store.ShareInfo {
+		w := st.serve(http.MethodGet, path, "", "")
+		if w.Code == http.StatusNotFound {
+			return nil
+		}
+		require.Equal(t, http.StatusOK, w.Code)
+		info := &store.ShareInfo{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), info))
+		return info
+	}
+
+	require.Nil(t, get())
+	sharePubKey := st.saveShare(t)
+	info := get()
+	require.Equal(t, sharePubKey, info.SharePubKey)
+	require.Equal(t, []types.OperatorID{testOperatorID}, info.OperatorIDs)
+	require.Nil(t, info.Retired)
+
+	// the share has to be retired before it is deleted
+	require.Equal(t, http.StatusConflict, st.serve(http.MethodDelete, path, "", "cli").Code)
+
+	requestID := hex.EncodeToString(make([]byte, len(dkg.RequestID{})))
+	require.NoError(t, st.h.RetiredShares.RecordResharing(requestID, &dkg.Reshare{ValidatorPK: st.vk, OperatorIDs: []types.OperatorID{2, 3, 4}}))
+	newShares := map[types.OperatorID]string{2: sharePubKey, 3: sharePubKey, 4: sharePubKey}
+
+	// not signed by the validator key
+	request := st.confirm(t, requestID, newShares)
+	request.Signature = st.confirm(t, "unknown", newShares).Signature
+	require.Equal(t, http.StatusBadRequest, retire(request))
+	// a resharing the node didn't join
+	require.Equal(t, http.StatusConflict, retire(st.confirm(t, "unknown", newShares)))
+	// shares that aren't of the new cluster of the resharing
+	require.Equal(t, http.StatusConflict, retire(st.confirm(t, requestID, map[types.OperatorID]string{2: sharePubKey, 3: sharePubKey})))
+	require.Nil(t, get().Retired)
+
+	require.Equal(t, http.StatusOK, retire(st.confirm(t, requestID, newShares)))
+	info = get()
+	require.NotNil(t, info.Retired)
+	require.Equal(t, requestID, info.Retired.RequestID)
+
+	require.Equal(t, http.StatusOK, st.serve(http.MethodDelete, path, "", "cli").Code)
+	require.Nil(t, get())
+	retired, err := st.h.RetiredShares.Get(st.vk)
+	require.NoError(t, err)
+	require.NotNil(t, retired.DeletedAt)
+}
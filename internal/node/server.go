@@ -22,22 +22,82 @@
 package node
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/metrics"
+	"github.com/RockX-SG/frost-dkg-demo/internal/policy"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tracing"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	DefaultShutdownGracePeriod = 30 * time.Second
+
+	drainPollInterval = 100 * time.Millisecond
+)
+
+var (
+	ErrShuttingDown   = errors.New("node is shutting down, no new ceremonies are accepted")
+	ErrInvalidKeySign = errors.New("invalid keysign request")
+)
+
+// CeremonyJoiner is implemented by networks that have to subscribe to a
+// ceremony before the messages of the other operators arrive
+type CeremonyJoiner interface {
+	Join(requestID string) error
+}
+
 type ApiHandler struct {
-	logger *logrus.Logger
+	// the messenger delivers messages of different ceremonies concurrently
+	// but dkg.Node isn't safe for concurrent use
+	mu sync.Mutex
+
+	Joiner CeremonyJoiner
+	// Policy decides which ceremonies the node joins, all of them if it's nil
+	Policy *policy.Policy
+	// SlashingProtection records the roots signed by keysign
+	SlashingProtection *store.SlashingProtection
+	// SupersededShares keeps the shares replaced by resharing until the new
+	// shares are confirmed
+	SupersededShares *store.SupersededShares
+	// RetiredShares marks the shares of validators the node left by resharing,
+	// they don't sign anymore
+	RetiredShares *store.RetiredShares
+
+	// draining refuses new ceremonies while the node shuts down
+	draining   atomic.Bool
+	ceremonies *ceremonyTracker
+	logger     *logrus.Logger
 }
 
 func New(logger *logrus.Logger) *ApiHandler {
-	return &ApiHandler{logger: logger}
+	return &ApiHandler{
+		ceremonies: newCeremonyTracker(),
+		logger:     logger,
+	}
+}
+
+// InstrumentNetwork wraps the network of the node so that ceremony durations
+// are observed when the node streams the output or blame
+func (h *ApiHandler) InstrumentNetwork(network dkg.Network) dkg.Network {
+	return &instrumentedNetwork{Network: network, tracker: h.ceremonies}
 }
 
 func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
@@ -45,6 +105,7 @@ func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
 		data, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			h.logger.Errorf("HandleConsume: failed to read request body: %v", err)
+			metrics.ConsumeErrors.WithLabelValues("read").Inc()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"message": "failed to load data from request body",
 				"error":   err.Error(),
@@ -55,6 +116,7 @@ func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
 		msg := &types.SSVMessage{}
 		if err = msg.Decode(data); err != nil {
 			h.logger.Errorf("HandleConsume: failed to parse data from request body: %v", err)
+			metrics.ConsumeErrors.WithLabelValues("decode").Inc()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"message": "failed to parse data from request body",
 				"error":   err.Error(),
@@ -62,8 +124,42 @@ func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
 			return
 		}
 
-		if err = node.ProcessMessage(msg); err != nil {
-			h.logger.Errorf("HandleConsume: dkg node failed to process incoming message: %v", err)
+		log := logger.ForRequest(h.logger, requestIDOf(msg))
+		var rejection *policy.Rejection
+		if err = h.admit(initiatorOf(c), msg); errors.Is(err, ErrShuttingDown) {
+			log.Warnf("HandleConsume: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"message": "dkg node didn't process message",
+				"error":   err.Error(),
+			})
+			return
+		} else if errors.As(err, &rejection) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "dkg node refused to join the ceremony",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			log.Errorf("HandleConsume: refused ceremony: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "dkg node refused to join the ceremony",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err = h.join(msg); err != nil {
+			log.Errorf("HandleConsume: failed to join ceremony: %v", err)
+			metrics.ConsumeErrors.WithLabelValues("join").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "failed to join ceremony",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err = h.process(c.Request.Context(), node, msg); err != nil {
+			log.Errorf("HandleConsume: dkg node failed to process incoming message: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"message": "dkg node failed to process message",
 				"error":   err.Error(),
@@ -71,7 +167,7 @@ func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
 			return
 		}
 
-		h.logger.Infof("HandleConsume: dkg node processed incoming message successfully")
+		log.Infof("HandleConsume: dkg node processed incoming message successfully")
 		c.JSON(http.StatusOK, gin.H{
 			"message": "processed message successfully",
 			"error":   nil,
@@ -79,6 +175,218 @@ func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
 	}
 }
 
+// ProcessMessage passes a message received from the p2p network to the node.
+// Such messages have no initiator, so the policy only lets them start
+// ceremonies if it doesn't restrict the initiators.
+func (h *ApiHandler) ProcessMessage(ctx context.Context, node *dkg.Node, msg *types.SSVMessage) error {
+	if err := h.admit(policy.Initiator{}, msg); err != nil {
+		return err
+	}
+	return h.process(ctx, node, msg)
+}
+
+// admit refuses messages that start a ceremony while the node shuts down or
+// if the policy doesn't allow the ceremony. Keysign requests are only admitted
+// if the node can recompute their signing root from their payload.
+func (h *ApiHandler) admit(initiator policy.Initiator, msg *types.SSVMessage) error {
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(msg.Data); err != nil || signedMsg.Message == nil {
+		// the node reports messages it can't decode
+		return nil
+	}
+	if _, starts := ceremonyType(signedMsg.Message.MsgType); !starts {
+		return nil
+	}
+	if h.draining.Load() {
+		return ErrShuttingDown
+	}
+	_, err := h.evaluate(initiator, hex.EncodeToString(signedMsg.Message.Identifier[:]), signedMsg.Message)
+	return err
+}
+
+// evaluate checks a message starting a ceremony against the policy. Keysign
+// and reshare requests for a retired share are refused. The payload of a
+// keysign request is verified and returned, and its signing root recorded for
+// slashing protection. Reshare requests are recorded for retiring the share.
+func (h *ApiHandler) evaluate(initiator policy.Initiator, requestID string, msg *dkg.Message) (*signing.KeySign, error) {
+	req := &policy.Request{
+		Initiator: initiator,
+		Message:   msg,
+	}
+	var (
+		keySign *signing.KeySign
+		reshare *dkg.Reshare
+	)
+	switch msg.MsgType {
+	case dkg.ReshareMsgType:
+		reshare = &dkg.Reshare{}
+		if err := reshare.Decode(msg.Data); err != nil {
+			return nil, fmt.Errorf("failed to decode reshare message: %w", err)
+		}
+		if err := h.checkRetired(reshare.ValidatorPK); err != nil {
+			return nil, err
+		}
+	case dkg.KeySignMsgType:
+		keySign = &signing.KeySign{}
+		if err := keySign.Decode(msg.Data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeySign, err)
+		}
+		if err := keySign.Verify(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeySign, err)
+		}
+		req.KeySignType = keySign.Payload.Type
+
+		if err := h.checkRetired(keySign.ValidatorPK); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.Policy != nil {
+		err := h.Policy.Evaluate(req)
+		var rejection *policy.Rejection
+		if errors.As(err, &rejection) {
+			metrics.PolicyRejections.WithLabelValues(rejection.Rule).Inc()
+			logger.ForRequest(h.logger, requestID).WithFields(logrus.Fields{
+				"initiator": initiator.String(),
+				"msg_type":  msgTypeName(msg.MsgType),
+				"rule":      rejection.Rule,
+			}).Warnf("admit: refused ceremony: %s", rejection.Reason)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the resharing is recorded so that it can retire the share of an
+	// operator it leaves out
+	if reshare != nil && h.RetiredShares != nil {
+		if err := h.RetiredShares.RecordResharing(requestID, reshare); err != nil {
+			return nil, err
+		}
+	}
+	if keySign != nil && h.SlashingProtection != nil {
+		if err := h.SlashingProtection.CheckAndRecord(keySign.ValidatorPK, keySign.SigningRoot, keySign.Payload.Type, requestID); err != nil {
+			return nil, err
+		}
+	}
+	return keySign, nil
+}
+
+// checkRetired refuses ceremonies with a retired share of the validator
+func (h *ApiHandler) checkRetired(validatorPK types.ValidatorPK) error {
+	if h.RetiredShares == nil {
+		return nil
+	}
+	retired, err := h.RetiredShares.Get(validatorPK)
+	if err != nil {
+		return err
+	}
+	if retired != nil {
+		return fmt.Errorf("%w by resharing %s", store.ErrShareRetired, retired.RequestID)
+	}
+	return nil
+}
+
+// initiatorOf identifies the client by its verified certificate, or by its IP
+// without one
+func initiatorOf(c *gin.Context) policy.Initiator {
+	initiator := policy.Initiator{IP: net.ParseIP(c.ClientIP())}
+	if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 && len(c.Request.TLS.VerifiedChains[0]) > 0 {
+		initiator.Name = c.Request.TLS.VerifiedChains[0][0].Subject.CommonName
+	} else {
+		initiator.Name = c.ClientIP()
+	}
+	return initiator
+}
+
+// process passes the message to the node, one message at a time. The trace
+// context of ctx is continued, messages without one, e.g. from the p2p
+// network, are traced within their ceremony.
+func (h *ApiHandler) process(ctx context.Context, node *dkg.Node, msg *types.SSVMessage) error {
+	msgType := "unknown"
+	attrs := make([]attribute.KeyValue, 0)
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(msg.Data); err == nil && signedMsg.Message != nil {
+		requestID := hex.EncodeToString(signedMsg.Message.Identifier[:])
+		round := messageRound(signedMsg)
+		msgType = msgTypeName(signedMsg.Message.MsgType)
+
+		h.ceremonies.start(ctx, signedMsg)
+		h.ceremonies.round(requestID, round)
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			ctx = tracing.CeremonyContext(requestID)
+		}
+		logger.ForRequest(h.logger, requestID).WithFields(logrus.Fields{
+			"signer":   signedMsg.Signer,
+			"msg_type": msgType,
+			"round":    round,
+		}).Debugf("ProcessMessage: processing message")
+		attrs = append(attrs,
+			tracing.RequestID(requestID),
+			attribute.Int("dkg.round", int(round)),
+			attribute.Int("dkg.signer", int(signedMsg.Signer)),
+		)
+	}
+	attrs = append(attrs, attribute.String("dkg.msg_type", msgType))
+	_, span := tracing.Tracer().Start(ctx, "dkg.process", trace.WithAttributes(attrs...))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := time.Now()
+	err := node.ProcessMessage(msg)
+	metrics.ConsumeDuration.WithLabelValues(msgType).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.ConsumeErrors.WithLabelValues("process").Inc()
+	}
+	tracing.EndWithError(span, err)
+	return err
+}
+
+// Drain refuses new ceremonies and waits until the running ones have streamed
+// their output or blame, or ctx is done
+func (h *ApiHandler) Drain(ctx context.Context) error {
+	h.draining.Store(true)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		running := h.ceremonies.running()
+		if len(running) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("ceremonies %v are still running: %w", running, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// requestIDOf returns the request ID of the message or an empty string if the
+// message can't be decoded
+func requestIDOf(msg *types.SSVMessage) string {
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(msg.Data); err != nil || signedMsg.Message == nil {
+		return ""
+	}
+	return hex.EncodeToString(signedMsg.Message.Identifier[:])
+}
+
+func (h *ApiHandler) join(msg *types.SSVMessage) error {
+	if h.Joiner == nil {
+		return nil
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(msg.Data); err != nil {
+		return err
+	}
+	if signedMsg.Message == nil {
+		return fmt.Errorf("signed message from %d has no message", signedMsg.Signer)
+	}
+	return h.Joiner.Join(hex.EncodeToString(signedMsg.Message.Identifier[:]))
+}
+
 func (h *ApiHandler) HandleGetDKGResults(node *dkg.Node) func(*gin.Context) {
 	return func(c *gin.Context) {
 		vkByte, _ := hex.DecodeString(c.Param("vk"))
@@ -0,0 +1,64 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/metrics"
+	"github.com/RockX-SG/frost-dkg-demo/internal/policy"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireInitiator guards the routes that change the key shares of the node.
+// The client has to present a certificate verified against the node's client
+// CA, and the policy has to allow it as an initiator.
+func (h *ApiHandler) RequireInitiator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "a verified client certificate is required to manage key shares",
+				"error":   "missing client certificate",
+			})
+			return
+		}
+		if h.Policy == nil {
+			c.Next()
+			return
+		}
+
+		initiator := initiatorOf(c)
+		err := h.Policy.Authorize(initiator)
+		var rejection *policy.Rejection
+		if errors.As(err, &rejection) {
+			metrics.PolicyRejections.WithLabelValues(rejection.Rule).Inc()
+			h.logger.Warnf("RequireInitiator: refused %s %s from %s: %s", c.Request.Method, c.Request.URL.Path, initiator, rejection.Reason)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"message": "dkg node refused to manage its key shares",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
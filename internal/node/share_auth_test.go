@@ -0,0 +1,152 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/policy"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gin-gonic/gin"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const testOperatorID = types.OperatorID(1)
+
+// shareTest is a node with the routes of cmd/node that manage key shares
+type shareTest struct {
+	h       *ApiHandler
+	storage dkg.Storage
+	router  *gin.Engine
+	// validator is the validator key, it signs the share confirmations
+	validator *bls.SecretKey
+	vk        types.ValidatorPK
+}
+
+func newShareTest(t *testing.T) *shareTest {
+	require.NoError(t, bls.Init(bls.BLS12_381))
+	require.NoError(t, bls.SetETHmode(bls.EthModeDraft07))
+	gin.SetMode(gin.TestMode)
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	st := &shareTest{
+		h:         New(logger),
+		storage:   store.NewStorage(db, testOperatorID, nil),
+		router:    gin.New(),
+		validator: &bls.SecretKey{},
+	}
+	st.h.SupersededShares = store.NewSupersededShares(db)
+	st.h.RetiredShares = store.NewRetiredShares(db)
+	st.validator.SetByCSPRNG()
+	st.vk = st.validator.GetPublicKey().Serialize()
+
+	node := dkg.NewNode(nil, &dkg.Config{Storage: st.storage})
+	st.router.GET("/shares/:vk", st.h.HandleGetShare(node))
+	shares := st.router.Group("/shares", st.h.RequireInitiator())
+	{
+		shares.POST("/:vk/confirm", st.h.HandleConfirmShare(testOperatorID))
+		shares.POST("/:vk/retire", st.h.HandleRetireShare(testOperatorID))
+		shares.DELETE("/:vk", st.h.HandleDeleteShare())
+	}
+	return st
+}
+
+// saveShare stores a new key share of the validator, superseding the one the
+// node held, and returns its public key
+func (st *shareTest) saveShare(t *testing.T) string {
+	share := &bls.SecretKey{}
+	share.SetByCSPRNG()
+	require.NoError(t, st.storage.SaveKeyGenOutput(&dkg.KeyGenOutput{
+		Share:           share,
+		OperatorPubKeys: map[types.OperatorID]*bls.PublicKey{testOperatorID: share.GetPublicKey()},
+		ValidatorPK:     st.vk,
+		Threshold:       1,
+	}))
+	return share.GetPublicKey().SerializeToHexStr()
+}
+
+// confirm signs the confirmation of the share public keys with the validator key
+func (st *shareTest) confirm(t *testing.T, requestID string, sharePubKeys map[types.OperatorID]string) *ConfirmShareRequest {
+	confirmation := &signing.ShareConfirmation{RequestID: requestID, SharePubKeys: sharePubKeys}
+	root, err := (&signing.Payload{Type: signing.TypeShareConfirmation, ShareConfirmation: confirmation}).SigningRoot(st.vk)
+	require.NoError(t, err)
+	return &ConfirmShareRequest{
+		Confirmation: confirmation,
+		Signature:    st.validator.SignByte(root).SerializeToHexStr(),
+	}
+}
+
+// serve sends the request with a verified client certificate of commonName,
+// or without a client certificate if commonName is empty
+func (st *shareTest) serve(method, path, body, commonName string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if commonName != "" {
+		req.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}},
+		}
+	}
+	w := httptest.NewRecorder()
+	st.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireInitiator(t *testing.T) {
+	st := newShareTest(t)
+	path := "/shares/" + hex.EncodeToString(st.vk)
+
+	// the certificate is checked before the share
+	w := st.serve(http.MethodDelete, path, "", "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(policyFile, []byte("initiators:\n  allowed: [cli]\n"), 0o600))
+	st.h.Policy, _ = policy.Load(policyFile)
+	require.NotNil(t, st.h.Policy)
+
+	w = st.serve(http.MethodDelete, path, "", "someone")
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// an allowed initiator reaches the handler, which keeps the share that isn't retired
+	w = st.serve(http.MethodDelete, path, "", "cli")
+	require.Equal(t, http.StatusConflict, w.Code)
+}
@@ -0,0 +1,140 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gin-gonic/gin"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+// ConfirmShareRequest is the confirmation of the new shares of a resharing or
+// refresh, with its signature by the validator key made with the new shares
+type ConfirmShareRequest struct {
+	Confirmation *signing.ShareConfirmation `json:"confirmation"`
+	Signature    string                     `json:"signature"`
+}
+
+// verifySignature checks the signature of the confirmation against the
+// validator key
+func (r *ConfirmShareRequest) verifySignature(vk types.ValidatorPK) error {
+	if r.Confirmation == nil || r.Signature == "" {
+		return fmt.Errorf("confirmation and signature are required")
+	}
+	root, err := (&signing.Payload{Type: signing.TypeShareConfirmation, ShareConfirmation: r.Confirmation}).SigningRoot(vk)
+	if err != nil {
+		return err
+	}
+
+	var (
+		pk  bls.PublicKey
+		sig bls.Sign
+	)
+	if err := pk.Deserialize(vk); err != nil {
+		return fmt.Errorf("invalid validator public key: %w", err)
+	}
+	if err := sig.DeserializeHexStr(strings.TrimPrefix(r.Signature, "0x")); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !sig.VerifyByte(&pk, root) {
+		return fmt.Errorf("signature of the confirmation doesn't verify against validator key %x", []byte(vk))
+	}
+	return nil
+}
+
+// verify checks the signature of the confirmation and returns the share
+// public key confirmed for the operator
+func (r *ConfirmShareRequest) verify(vk types.ValidatorPK, operatorID types.OperatorID) (string, error) {
+	if err := r.verifySignature(vk); err != nil {
+		return "", err
+	}
+	sharePubKey, ok := r.Confirmation.SharePubKeys[operatorID]
+	if !ok {
+		return "", fmt.Errorf("confirmation has no share of operator %d", operatorID)
+	}
+	return sharePubKey, nil
+}
+
+// HandleConfirmShare deletes the key shares of the validator that a resharing
+// or refresh superseded, once the cli confirmed the new shares of all
+// operators with a signature of the validator key made with the new shares
+func (h *ApiHandler) HandleConfirmShare(operatorID types.OperatorID) func(*gin.Context) {
+	return func(c *gin.Context) {
+		vk, err := hex.DecodeString(c.Param("vk"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid validator public key",
+				"error":   err.Error(),
+			})
+			return
+		}
+		request := &ConfirmShareRequest{}
+		if err := c.ShouldBindJSON(request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid share confirmation",
+				"error":   err.Error(),
+			})
+			return
+		}
+		sharePubKey, err := request.verify(vk, operatorID)
+		if err != nil {
+			h.logger.Warnf("HandleConfirmShare: validator %x: %v", vk, err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid share confirmation",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		deleted, err := h.SupersededShares.Delete(vk, sharePubKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "dkg node has no key share of the validator",
+				"error":   err.Error(),
+			})
+			return
+		} else if errors.Is(err, store.ErrShareMismatch) {
+			h.logger.Warnf("HandleConfirmShare: validator %x: %v", vk, err)
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "dkg node kept the superseded key shares",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			h.logger.Errorf("HandleConfirmShare: failed to delete superseded key shares of validator %x: %v", vk, err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		h.logger.Infof("HandleConfirmShare: deleted %d superseded key shares of validator %x confirmed by resharing %s", deleted, vk, request.Confirmation.RequestID)
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+	}
+}
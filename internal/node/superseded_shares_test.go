@@ -0,0 +1,67 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleConfirmShare(t *testing.T) {
+	st := newShareTest(t)
+	path := "/shares/" + hex.EncodeToString(st.vk) + "/confirm"
+	confirm := func(request *ConfirmShareRequest) int {
+		data, err := json.Marshal(request)
+		require.NoError(t, err)
+		return st.serve(http.MethodPost, path, string(data), "cli").Code
+	}
+
+	st.saveShare(t)
+	sharePubKey := st.saveShare(t)
+	count := func() int {
+		count, err := st.h.SupersededShares.Count(st.vk)
+		require.NoError(t, err)
+		return count
+	}
+	require.Equal(t, 1, count())
+
+	// not signed by the validator key
+	request := st.confirm(t, "request-1", map[types.OperatorID]string{testOperatorID: sharePubKey, 2: sharePubKey})
+	request.Confirmation.RequestID = "request-2"
+	require.Equal(t, http.StatusBadRequest, confirm(request))
+
+	// no share of the operator
+	require.Equal(t, http.StatusBadRequest, confirm(st.confirm(t, "request-1", map[types.OperatorID]string{2: sharePubKey})))
+
+	// the node holds another share than the one confirmed
+	other := st.validator.GetPublicKey().SerializeToHexStr()
+	require.Equal(t, http.StatusConflict, confirm(st.confirm(t, "request-1", map[types.OperatorID]string{testOperatorID: other})))
+	require.Equal(t, 1, count())
+
+	require.Equal(t, http.StatusOK, confirm(st.confirm(t, "request-1", map[types.OperatorID]string{testOperatorID: sharePubKey})))
+	require.Equal(t, 0, count())
+}
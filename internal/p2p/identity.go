@@ -0,0 +1,67 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package p2p
+
+import (
+	"crypto/rand"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+const identityKey = "p2p/identity"
+
+// LoadOrCreateIdentity returns the libp2p key of this node, generating and
+// storing one on first use so that the peer ID in other nodes' bootstrap
+// lists stays valid across restarts. It is independent of the operator key.
+func LoadOrCreateIdentity(db *badger.DB) (crypto.PrivKey, error) {
+	var val []byte
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(identityKey))
+		if err != nil {
+			return err
+		}
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == nil {
+		return crypto.UnmarshalPrivateKey(val)
+	}
+	if err != badger.ErrKeyNotFound {
+		return nil, err
+	}
+
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	val, err = crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(identityKey), val)
+	}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,385 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package p2p
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	DefaultListenAddr = "/ip4/0.0.0.0/tcp/4001"
+)
+
+const (
+	topicPrefix       = "dkg/"
+	reconnectInterval = 30 * time.Second
+	connectTimeout    = 10 * time.Second
+	republishDelay    = time.Second
+	// a ceremony topic is kept for a while after the output so that peers
+	// that are still behind can catch up
+	topicLinger = time.Minute
+)
+
+type Config struct {
+	ListenAddrs []string
+	// Bootstrap is the static list of peers, as multiaddrs ending with /p2p/<peer id>,
+	// this node keeps connections to. It should contain the other operators.
+	Bootstrap []string
+	Identity  crypto.PrivKey
+}
+
+// Handler processes a message received from the network
+type Handler func(msg *types.SSVMessage) error
+
+// Network is a dkg.Network exchanging protocol messages over libp2p gossipsub
+// with a topic per ceremony, named by the request ID, instead of the messenger.
+// DKG outputs and blames stay with the node and are served through HandleGetData.
+type Network struct {
+	host      host.Host
+	ps        *pubsub.PubSub
+	bootstrap []peer.AddrInfo
+	handler   Handler
+
+	mu         sync.Mutex
+	ceremonies map[string]*ceremony
+	results    map[string]*messenger.DataStore
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger *logrus.Logger
+}
+
+type ceremony struct {
+	topic  *pubsub.Topic
+	sub    *pubsub.Subscription
+	events *pubsub.TopicEventHandler
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// messages published by this node, sent again whenever a peer joins the
+	// topic late as gossipsub doesn't keep a history
+	published [][]byte
+	seen      map[[32]byte]bool
+}
+
+func New(cfg *Config, logger *logrus.Logger) (*Network, error) {
+	if len(cfg.ListenAddrs) == 0 {
+		cfg.ListenAddrs = []string{DefaultListenAddr}
+	}
+
+	bootstrap := make([]peer.AddrInfo, 0, len(cfg.Bootstrap))
+	for _, addr := range cfg.Bootstrap {
+		info, err := peer.AddrInfoFromString(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peer %s: %w", addr, err)
+		}
+		bootstrap = append(bootstrap, *info)
+	}
+
+	opts := []libp2p.Option{libp2p.ListenAddrStrings(cfg.ListenAddrs...)}
+	if cfg.Identity != nil {
+		opts = append(opts, libp2p.Identity(cfg.Identity))
+	}
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create libp2p host: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ps, err := pubsub.NewGossipSub(ctx, h)
+	if err != nil {
+		cancel()
+		h.Close()
+		return nil, fmt.Errorf("failed to create gossipsub: %w", err)
+	}
+
+	n := &Network{
+		host:       h,
+		ps:         ps,
+		bootstrap:  bootstrap,
+		ceremonies: make(map[string]*ceremony),
+		results:    make(map[string]*messenger.DataStore),
+		ctx:        ctx,
+		cancel:     cancel,
+		logger:     logger,
+	}
+	go n.maintainConnections()
+	return n, nil
+}
+
+// SetHandler sets the handler for messages of other operators. It has to be set
+// before the first ceremony is joined.
+func (n *Network) SetHandler(handler Handler) {
+	n.handler = handler
+}
+
+// Addrs returns the full multiaddrs other nodes can use to bootstrap from this node
+func (n *Network) Addrs() []string {
+	addrs := make([]string, 0)
+	for _, addr := range n.host.Addrs() {
+		addrs = append(addrs, fmt.Sprintf("%s/p2p/%s", addr, n.host.ID()))
+	}
+	return addrs
+}
+
+func (n *Network) Close() error {
+	n.cancel()
+	return n.host.Close()
+}
+
+func (n *Network) maintainConnections() {
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, info := range n.bootstrap {
+			if info.ID == n.host.ID() || n.host.Network().Connectedness(info.ID) == network.Connected {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(n.ctx, connectTimeout)
+			if err := n.host.Connect(ctx, info); err != nil {
+				n.logger.Warnf("p2p: failed to connect to bootstrap peer %s: %v", info.ID, err)
+			} else {
+				n.logger.Infof("p2p: connected to bootstrap peer %s", info.ID)
+			}
+			cancel()
+		}
+
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Join subscribes to the topic of the ceremony. The node joins when it gets the
+// init message so that it doesn't miss the first round of the other operators.
+func (n *Network) Join(requestID string) error {
+	_, err := n.join(requestID)
+	return err
+}
+
+func (n *Network) join(requestID string) (*ceremony, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if c, ok := n.ceremonies[requestID]; ok {
+		return c, nil
+	}
+
+	topic, err := n.ps.Join(topicPrefix + requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join topic of request %s: %w", requestID, err)
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		topic.Close()
+		return nil, fmt.Errorf("failed to subscribe to topic of request %s: %w", requestID, err)
+	}
+	events, err := topic.EventHandler()
+	if err != nil {
+		sub.Cancel()
+		topic.Close()
+		return nil, fmt.Errorf("failed to watch peers of topic of request %s: %w", requestID, err)
+	}
+
+	ctx, cancel := context.WithCancel(n.ctx)
+	c := &ceremony{
+		topic:     topic,
+		sub:       sub,
+		events:    events,
+		cancel:    cancel,
+		published: make([][]byte, 0),
+		seen:      make(map[[32]byte]bool),
+	}
+	n.ceremonies[requestID] = c
+
+	go n.readLoop(ctx, requestID, c)
+	go n.republishLoop(ctx, requestID, c)
+	return c, nil
+}
+
+func (n *Network) leave(requestID string) {
+	n.mu.Lock()
+	c, ok := n.ceremonies[requestID]
+	delete(n.ceremonies, requestID)
+	n.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	c.cancel()
+	c.events.Cancel()
+	c.sub.Cancel()
+	if err := c.topic.Close(); err != nil {
+		logger.ForRequest(n.logger, requestID).Warnf("p2p: failed to close topic of request %s: %v", requestID, err)
+	}
+}
+
+func (n *Network) readLoop(ctx context.Context, requestID string, c *ceremony) {
+	for {
+		msg, err := c.sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if msg.ReceivedFrom == n.host.ID() {
+			continue
+		}
+
+		// republished messages are delivered again to peers that already got them
+		digest := sha256.Sum256(msg.Data)
+		c.mu.Lock()
+		seen := c.seen[digest]
+		c.seen[digest] = true
+		c.mu.Unlock()
+		if seen {
+			continue
+		}
+
+		ssvMsg := &types.SSVMessage{}
+		if err := ssvMsg.Decode(msg.Data); err != nil {
+			logger.ForRequest(n.logger, requestID).Errorf("p2p: failed to decode message for request %s from %s: %v", requestID, msg.ReceivedFrom, err)
+			continue
+		}
+		if n.handler == nil {
+			continue
+		}
+		if err := n.handler(ssvMsg); err != nil {
+			logger.ForRequest(n.logger, requestID).Errorf("p2p: failed to process message for request %s from %s: %v", requestID, msg.ReceivedFrom, err)
+		}
+	}
+}
+
+func (n *Network) republishLoop(ctx context.Context, requestID string, c *ceremony) {
+	for {
+		evt, err := c.events.NextPeerEvent(ctx)
+		if err != nil {
+			return
+		}
+		if evt.Type != pubsub.PeerJoin {
+			continue
+		}
+
+		// the join is seen as soon as the peer announces its subscription, which
+		// can be before the stream to the peer is ready
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(republishDelay):
+		}
+
+		c.mu.Lock()
+		published := make([][]byte, len(c.published))
+		copy(published, c.published)
+		c.mu.Unlock()
+
+		for _, data := range published {
+			if err := c.topic.Publish(ctx, data); err != nil {
+				logger.ForRequest(n.logger, requestID).Warnf("p2p: failed to republish message for request %s to %s: %v", requestID, evt.Peer, err)
+			}
+		}
+	}
+}
+
+func (n *Network) publish(requestID string, data []byte) error {
+	c, err := n.join(requestID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.published = append(c.published, data)
+	c.mu.Unlock()
+
+	return c.topic.Publish(n.ctx, data)
+}
+
+func (n *Network) BroadcastDKGMessage(msg *dkg.SignedMessage) error {
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+
+	msgBytes, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+	ssvMsg := types.SSVMessage{
+		MsgType: types.DKGMsgType,
+		Data:    msgBytes,
+	}
+	ssvMsgBytes, err := ssvMsg.Encode()
+	if err != nil {
+		return err
+	}
+	return n.publish(requestID, ssvMsgBytes)
+}
+
+func (n *Network) StreamDKGOutput(output map[types.OperatorID]*dkg.SignedOutput) error {
+	var requestID string
+	for _, output := range output {
+		if output.Data != nil {
+			requestID = hex.EncodeToString(output.Data.RequestID[:])
+		} else if output.KeySignData != nil {
+			requestID = hex.EncodeToString(output.KeySignData.RequestID[:])
+		}
+	}
+
+	n.storeResult(requestID, &messenger.DataStore{DKGOutputs: output})
+	return nil
+}
+
+func (n *Network) StreamDKGBlame(blame *dkg.BlameOutput) error {
+	requestID := hex.EncodeToString(blame.BlameMessage.Message.Identifier[:])
+	n.storeResult(requestID, &messenger.DataStore{BlameOutput: blame})
+	return nil
+}
+
+func (n *Network) storeResult(requestID string, data *messenger.DataStore) {
+	n.mu.Lock()
+	n.results[requestID] = data
+	n.mu.Unlock()
+
+	time.AfterFunc(topicLinger, func() { n.leave(requestID) })
+}
+
+func (n *Network) Result(requestID string) (*messenger.DataStore, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	data, ok := n.results[requestID]
+	return data, ok
+}
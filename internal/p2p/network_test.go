@@ -0,0 +1,125 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package p2p
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNetworks(t *testing.T, num int) ([]*Network, []chan *dkg.SignedMessage) {
+	networks := make([]*Network, 0, num)
+	received := make([]chan *dkg.SignedMessage, 0, num)
+	bootstrap := make([]string, 0)
+
+	for i := 0; i < num; i++ {
+		n, err := New(&Config{
+			ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"},
+			Bootstrap:   bootstrap,
+		}, logrus.New())
+		require.NoError(t, err)
+		t.Cleanup(func() { n.Close() })
+
+		ch := make(chan *dkg.SignedMessage, 100)
+		n.SetHandler(func(msg *types.SSVMessage) error {
+			signedMsg := &dkg.SignedMessage{}
+			if err := signedMsg.Decode(msg.Data); err != nil {
+				return err
+			}
+			ch <- signedMsg
+			return nil
+		})
+
+		networks = append(networks, n)
+		received = append(received, ch)
+		bootstrap = append(bootstrap, n.Addrs()...)
+	}
+	return networks, received
+}
+
+func expectMessage(t *testing.T, ch chan *dkg.SignedMessage, signer types.OperatorID) {
+	select {
+	case msg := <-ch:
+		require.Equal(t, signer, msg.Signer)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("message from %d wasn't delivered", signer)
+	}
+}
+
+func TestBroadcastDKGMessage(t *testing.T) {
+	networks, received := newTestNetworks(t, 4)
+
+	requestID := dkg.RequestID{1, 2, 3}
+	topic := hex.EncodeToString(requestID[:])
+
+	// the last node joins the ceremony late and still gets the message
+	for _, n := range networks[:3] {
+		require.NoError(t, n.Join(topic))
+	}
+
+	msg := &dkg.SignedMessage{
+		Message: &dkg.Message{
+			MsgType:    dkg.ProtocolMsgType,
+			Identifier: requestID,
+			Data:       []byte("round 1"),
+		},
+		Signer: 1,
+	}
+	require.NoError(t, networks[0].BroadcastDKGMessage(msg))
+
+	expectMessage(t, received[1], 1)
+	expectMessage(t, received[2], 1)
+
+	require.NoError(t, networks[3].Join(topic))
+	expectMessage(t, received[3], 1)
+
+	// republishing for the late node must not deliver the message twice
+	select {
+	case <-received[0]:
+		t.Fatal("node received its own message")
+	case <-received[1]:
+		t.Fatal("message was delivered twice")
+	case <-time.After(2 * time.Second):
+	}
+}
+
+func TestStreamDKGBlame(t *testing.T) {
+	networks, _ := newTestNetworks(t, 1)
+
+	requestID := dkg.RequestID{4, 5, 6}
+	blame := &dkg.BlameOutput{
+		BlameMessage: &dkg.SignedMessage{
+			Message: &dkg.Message{Identifier: requestID},
+		},
+	}
+	require.NoError(t, networks[0].StreamDKGBlame(blame))
+
+	data, ok := networks[0].Result(hex.EncodeToString(requestID[:]))
+	require.True(t, ok)
+	require.Equal(t, blame, data.BlameOutput)
+}
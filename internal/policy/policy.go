@@ -0,0 +1,402 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package policy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules a ceremony can be rejected by
+const (
+	RuleInitiator  = "initiator"
+	RuleRateLimit  = "rate_limit"
+	RuleCluster    = "cluster"
+	RuleThreshold  = "threshold"
+	RuleWithdrawal = "withdrawal_address"
+	RuleFork       = "fork"
+	RuleKeySign    = "keysign_type"
+)
+
+// forks are the fork versions that can be given by network name
+var forks = map[string][4]byte{
+	"mainnet": {0x00, 0x00, 0x00, 0x00},
+	"prater":  {0x00, 0x00, 0x10, 0x20},
+	"holesky": {0x01, 0x01, 0x70, 0x00},
+}
+
+// Policy decides which ceremonies the node takes part in. It is evaluated for
+// the messages that start a ceremony, init, reshare and keysign. Rules that
+// aren't set allow everything.
+type Policy struct {
+	Initiators InitiatorRules `yaml:"initiators" toml:"initiators"`
+	Cluster    ClusterRules   `yaml:"cluster" toml:"cluster"`
+	// WithdrawalAddresses are the execution addresses keygen ceremonies may use
+	// in 0x01 withdrawal credentials
+	WithdrawalAddresses []string `yaml:"withdrawal_addresses" toml:"withdrawal_addresses"`
+	// Forks are network names, mainnet, prater or holesky, or hex fork versions
+	Forks   []string     `yaml:"forks" toml:"forks"`
+	KeySign KeySignRules `yaml:"keysign" toml:"keysign"`
+
+	initiatorNames map[string]bool
+	initiatorNets  []*net.IPNet
+	withdrawal     map[common.Address]bool
+	forks          map[[4]byte]bool
+	keySignTypes   map[string]bool
+	limiter        *rateLimiter
+}
+
+type InitiatorRules struct {
+	// Allowed are certificate common names, IPs or CIDRs of the clients that
+	// may start ceremonies
+	Allowed   []string   `yaml:"allowed" toml:"allowed"`
+	RateLimit *RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// RateLimit allows every initiator the number of ceremonies within the
+// duration Per, e.g. 10 per 1h
+type RateLimit struct {
+	Ceremonies int    `yaml:"ceremonies" toml:"ceremonies"`
+	Per        string `yaml:"per" toml:"per"`
+}
+
+// ClusterRules apply to the operators and the threshold of keygen and to the
+// new operators and threshold of resharing
+type ClusterRules struct {
+	MinSize      int `yaml:"min_size" toml:"min_size"`
+	MaxSize      int `yaml:"max_size" toml:"max_size"`
+	MinThreshold int `yaml:"min_threshold" toml:"min_threshold"`
+	MaxThreshold int `yaml:"max_threshold" toml:"max_threshold"`
+	// MinThresholdRatio is the minimum threshold as a fraction of the cluster size, e.g. 0.67
+	MinThresholdRatio float64 `yaml:"min_threshold_ratio" toml:"min_threshold_ratio"`
+}
+
+type KeySignRules struct {
+	// AllowedTypes are the types of signing roots the node signs. Keysign
+	// requests whose signing root isn't verified to be of one of them are refused.
+	AllowedTypes []string `yaml:"allowed_types" toml:"allowed_types"`
+}
+
+// Initiator identifies the client that sent a message starting a ceremony.
+// Messages from the p2p network have no initiator.
+type Initiator struct {
+	// Name is the common name of the verified client certificate, or the IP
+	// without one
+	Name string
+	IP   net.IP
+}
+
+func (i Initiator) String() string {
+	if i.Name == "" {
+		return "unknown"
+	}
+	return i.Name
+}
+
+// Request is a message starting a ceremony
+type Request struct {
+	Initiator Initiator
+	Message   *dkg.Message
+	// KeySignType is the verified type of the signing root of a keysign request,
+	// empty if the root has no known type
+	KeySignType string
+}
+
+// Rejection is returned for ceremonies the policy doesn't allow
+type Rejection struct {
+	Rule   string
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("rejected by policy rule %s: %s", r.Rule, r.Reason)
+}
+
+func reject(rule, format string, args ...interface{}) *Rejection {
+	return &Rejection{Rule: rule, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Load reads the policy from a yaml or toml file depending on its extension.
+// Unknown keys are rejected so that a typo doesn't silently allow everything.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	p := &Policy{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(p); err != nil {
+			// the details name the unknown keys
+			var strictErr *toml.StrictMissingError
+			if errors.As(err, &strictErr) {
+				return nil, fmt.Errorf("failed to parse policy file %s: %s", path, strictErr.String())
+			}
+			return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported policy file %s, must be .yaml, .yml or .toml", path)
+	}
+
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// compile validates the rules and prepares them for evaluation, every problem
+// is reported
+func (p *Policy) compile() error {
+	errs := make([]error, 0)
+
+	p.initiatorNames = make(map[string]bool)
+	p.initiatorNets = make([]*net.IPNet, 0)
+	for _, allowed := range p.Initiators.Allowed {
+		if strings.Contains(allowed, "/") {
+			_, ipNet, err := net.ParseCIDR(allowed)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid initiators.allowed %s: %w", allowed, err))
+				continue
+			}
+			p.initiatorNets = append(p.initiatorNets, ipNet)
+		} else if ip := net.ParseIP(allowed); ip != nil {
+			p.initiatorNets = append(p.initiatorNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		} else {
+			p.initiatorNames[allowed] = true
+		}
+	}
+
+	if limit := p.Initiators.RateLimit; limit != nil {
+		per, err := time.ParseDuration(limit.Per)
+		if err != nil || per <= 0 {
+			errs = append(errs, fmt.Errorf("invalid initiators.rate_limit.per %q, must be a positive duration", limit.Per))
+		}
+		if limit.Ceremonies <= 0 {
+			errs = append(errs, fmt.Errorf("invalid initiators.rate_limit.ceremonies %d, must be positive", limit.Ceremonies))
+		}
+		p.limiter = newRateLimiter(limit.Ceremonies, per)
+	}
+
+	c := p.Cluster
+	if c.MinSize < 0 || c.MaxSize < 0 || c.MinThreshold < 0 || c.MaxThreshold < 0 {
+		errs = append(errs, fmt.Errorf("cluster sizes and thresholds can't be negative"))
+	}
+	if c.MaxSize > 0 && c.MinSize > c.MaxSize {
+		errs = append(errs, fmt.Errorf("cluster.min_size %d is larger than cluster.max_size %d", c.MinSize, c.MaxSize))
+	}
+	if c.MaxThreshold > 0 && c.MinThreshold > c.MaxThreshold {
+		errs = append(errs, fmt.Errorf("cluster.min_threshold %d is larger than cluster.max_threshold %d", c.MinThreshold, c.MaxThreshold))
+	}
+	if c.MinThresholdRatio < 0 || c.MinThresholdRatio > 1 {
+		errs = append(errs, fmt.Errorf("invalid cluster.min_threshold_ratio %v, must be between 0 and 1", c.MinThresholdRatio))
+	}
+
+	p.withdrawal = make(map[common.Address]bool)
+	for _, addr := range p.WithdrawalAddresses {
+		if !common.IsHexAddress(addr) {
+			errs = append(errs, fmt.Errorf("invalid withdrawal_addresses %s", addr))
+			continue
+		}
+		p.withdrawal[common.HexToAddress(addr)] = true
+	}
+
+	p.forks = make(map[[4]byte]bool)
+	for _, name := range p.Forks {
+		fork, err := parseFork(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p.forks[fork] = true
+	}
+
+	p.keySignTypes = make(map[string]bool)
+	for _, typ := range p.KeySign.AllowedTypes {
+		if !signing.IsType(typ) {
+			errs = append(errs, fmt.Errorf("invalid keysign.allowed_types %s, must be %s, %s, %s or %s",
+				typ, signing.TypeSSVOwnerNonce, signing.TypeVoluntaryExit, signing.TypeValidatorRegistration, signing.TypeShareConfirmation))
+			continue
+		}
+		p.keySignTypes[typ] = true
+	}
+	return errors.Join(errs...)
+}
+
+func parseFork(fork string) ([4]byte, error) {
+	if version, ok := forks[fork]; ok {
+		return version, nil
+	}
+	version := [4]byte{}
+	b, err := hex.DecodeString(strings.TrimPrefix(fork, "0x"))
+	if err != nil || len(b) != len(version) {
+		return version, fmt.Errorf("invalid forks %s, must be mainnet, prater, holesky or a 4 byte hex fork version", fork)
+	}
+	copy(version[:], b)
+	return version, nil
+}
+
+// Evaluate returns a *Rejection if the policy doesn't allow the ceremony.
+// Ceremonies that are allowed count towards the rate limit of the initiator.
+func (p *Policy) Evaluate(req *Request) error {
+	if err := p.checkInitiator(req.Initiator); err != nil {
+		return err
+	}
+
+	switch req.Message.MsgType {
+	case dkg.InitMsgType:
+		init := &dkg.Init{}
+		if err := init.Decode(req.Message.Data); err != nil {
+			return fmt.Errorf("failed to decode init message: %w", err)
+		}
+		if err := p.checkCluster(len(init.OperatorIDs), int(init.Threshold)); err != nil {
+			return err
+		}
+		if err := p.checkWithdrawal(init.WithdrawalCredentials); err != nil {
+			return err
+		}
+		if err := p.checkFork(init.Fork); err != nil {
+			return err
+		}
+	case dkg.ReshareMsgType:
+		reshare := &dkg.Reshare{}
+		if err := reshare.Decode(req.Message.Data); err != nil {
+			return fmt.Errorf("failed to decode reshare message: %w", err)
+		}
+		if err := p.checkCluster(len(reshare.OperatorIDs), int(reshare.Threshold)); err != nil {
+			return err
+		}
+	case dkg.KeySignMsgType:
+		if err := p.checkKeySign(req.KeySignType); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	if p.limiter != nil && !p.limiter.allow(req.Initiator.String(), time.Now()) {
+		return reject(RuleRateLimit, "initiator %s started more than %d ceremonies within %s",
+			req.Initiator, p.Initiators.RateLimit.Ceremonies, p.Initiators.RateLimit.Per)
+	}
+	return nil
+}
+
+// Authorize returns a *Rejection if the initiator isn't allowed to manage the
+// key shares of the node. It doesn't count towards the rate limit.
+func (p *Policy) Authorize(initiator Initiator) error {
+	return p.checkInitiator(initiator)
+}
+
+func (p *Policy) checkInitiator(initiator Initiator) error {
+	if len(p.Initiators.Allowed) == 0 {
+		return nil
+	}
+	if initiator.Name != "" && p.initiatorNames[initiator.Name] {
+		return nil
+	}
+	if initiator.IP != nil {
+		for _, ipNet := range p.initiatorNets {
+			if ipNet.Contains(initiator.IP) {
+				return nil
+			}
+		}
+	}
+	return reject(RuleInitiator, "initiator %s isn't allowed", initiator)
+}
+
+func (p *Policy) checkCluster(size, threshold int) error {
+	c := p.Cluster
+	if c.MinSize > 0 && size < c.MinSize {
+		return reject(RuleCluster, "cluster of %d operators is smaller than %d", size, c.MinSize)
+	}
+	if c.MaxSize > 0 && size > c.MaxSize {
+		return reject(RuleCluster, "cluster of %d operators is larger than %d", size, c.MaxSize)
+	}
+	if c.MinThreshold > 0 && threshold < c.MinThreshold {
+		return reject(RuleThreshold, "threshold %d is lower than %d", threshold, c.MinThreshold)
+	}
+	if c.MaxThreshold > 0 && threshold > c.MaxThreshold {
+		return reject(RuleThreshold, "threshold %d is higher than %d", threshold, c.MaxThreshold)
+	}
+	if c.MinThresholdRatio > 0 && float64(threshold) < c.MinThresholdRatio*float64(size) {
+		return reject(RuleThreshold, "threshold %d is lower than %v of the %d operators", threshold, c.MinThresholdRatio, size)
+	}
+	return nil
+}
+
+// checkWithdrawal only allows 0x01 withdrawal credentials to one of the
+// allowed execution addresses, which are the last 20 bytes of the credentials
+func (p *Policy) checkWithdrawal(credentials []byte) error {
+	if len(p.withdrawal) == 0 {
+		return nil
+	}
+	if len(credentials) != 32 || credentials[0] != 0x01 {
+		return reject(RuleWithdrawal, "withdrawal credentials %x aren't 0x01 credentials to an execution address", credentials)
+	}
+	addr := common.BytesToAddress(credentials[12:])
+	if !p.withdrawal[addr] {
+		return reject(RuleWithdrawal, "withdrawal address %s isn't allowed", addr.Hex())
+	}
+	return nil
+}
+
+func (p *Policy) checkFork(fork [4]byte) error {
+	if len(p.forks) == 0 || p.forks[fork] {
+		return nil
+	}
+	return reject(RuleFork, "fork version %x isn't allowed", fork)
+}
+
+func (p *Policy) checkKeySign(typ string) error {
+	if len(p.keySignTypes) == 0 {
+		return nil
+	}
+	if typ == "" {
+		return reject(RuleKeySign, "signing root isn't of a type the node can verify")
+	}
+	if !p.keySignTypes[typ] {
+		return reject(RuleKeySign, "signing root of type %s isn't allowed", typ)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package policy
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+initiators:
+  allowed: [cli.rockx.com, 10.0.0.0/8]
+  rate_limit:
+    ceremonies: 2
+    per: 1h
+cluster:
+  min_size: 4
+  max_size: 7
+  min_threshold_ratio: 0.66
+withdrawal_addresses: ["0x535953b5a6040074948cf185eaa7d2abbd66808f"]
+forks: [holesky]
+keysign:
+  allowed_types: [voluntary_exit]
+`
+
+func writePolicy(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func initMsg(t *testing.T, operators []types.OperatorID, threshold uint16, withdrawal common.Address, fork [4]byte) *dkg.Message {
+	credentials := make([]byte, 32)
+	credentials[0] = 0x01
+	copy(credentials[12:], withdrawal[:])
+	data, err := (&dkg.Init{
+		OperatorIDs:           operators,
+		Threshold:             threshold,
+		WithdrawalCredentials: credentials,
+		Fork:                  fork,
+	}).Encode()
+	require.NoError(t, err)
+	return &dkg.Message{MsgType: dkg.InitMsgType, Data: data}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Load(writePolicy(t, "policy.yaml", testPolicy))
+	require.NoError(t, err)
+
+	allowed := common.HexToAddress("0x535953b5a6040074948cf185eaa7d2abbd66808f")
+	holesky := [4]byte{0x01, 0x01, 0x70, 0x00}
+	operators := []types.OperatorID{1, 2, 3, 4}
+	cli := Initiator{Name: "cli.rockx.com"}
+
+	tests := []struct {
+		name      string
+		initiator Initiator
+		msg       *dkg.Message
+		rule      string
+	}{
+		{"allowed", cli, initMsg(t, operators, 3, allowed, holesky), ""},
+		{"allowed by ip", Initiator{Name: "10.1.2.3", IP: net.ParseIP("10.1.2.3")}, initMsg(t, operators, 3, allowed, holesky), ""},
+		{"unknown initiator", Initiator{Name: "192.168.0.1", IP: net.ParseIP("192.168.0.1")}, initMsg(t, operators, 3, allowed, holesky), RuleInitiator},
+		{"no initiator", Initiator{}, initMsg(t, operators, 3, allowed, holesky), RuleInitiator},
+		{"small cluster", cli, initMsg(t, operators[:3], 2, allowed, holesky), RuleCluster},
+		{"low threshold", cli, initMsg(t, operators, 2, allowed, holesky), RuleThreshold},
+		{"withdrawal address", cli, initMsg(t, operators, 3, common.Address{1}, holesky), RuleWithdrawal},
+		{"fork", cli, initMsg(t, operators, 3, allowed, [4]byte{}), RuleFork},
+		{"untyped keysign", cli, &dkg.Message{MsgType: dkg.KeySignMsgType}, RuleKeySign},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := p.Evaluate(&Request{Initiator: test.initiator, Message: test.msg})
+			if test.rule == "" {
+				require.NoError(t, err)
+				return
+			}
+			rejection := &Rejection{}
+			require.ErrorAs(t, err, &rejection)
+			require.Equal(t, test.rule, rejection.Rule)
+		})
+	}
+
+	// the first allowed ceremony of the initiator was in the table above
+	require.NoError(t, p.Evaluate(&Request{Initiator: cli, Message: initMsg(t, operators, 3, allowed, holesky)}))
+	err = p.Evaluate(&Request{Initiator: cli, Message: initMsg(t, operators, 3, allowed, holesky)})
+	rejection := &Rejection{}
+	require.ErrorAs(t, err, &rejection)
+	require.Equal(t, RuleRateLimit, rejection.Rule)
+
+	// managing the key shares doesn't count towards the rate limit
+	require.NoError(t, p.Authorize(cli))
+	require.ErrorAs(t, p.Authorize(Initiator{Name: "192.168.0.1", IP: net.ParseIP("192.168.0.1")}), &rejection)
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := Load(writePolicy(t, "policy.yaml", `
+initiators:
+  allowed: [10.0.0.0/33]
+cluster:
+  min_size: 7
+  max_size: 4
+forks: [sepolia]
+keysign:
+  allowed_types: [anything]
+`))
+	require.Error(t, err)
+	require.Len(t, strings.Split(err.Error(), "\n"), 4, err.Error())
+
+	_, err = Load(writePolicy(t, "policy.toml", "[cluster]\nmin_sizes = 4\n"))
+	require.ErrorContains(t, err, "min_sizes")
+}
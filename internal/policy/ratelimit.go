@@ -0,0 +1,64 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package policy
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a sliding window of the ceremonies started by every initiator
+type rateLimiter struct {
+	limit int
+	per   time.Duration
+
+	mu     sync.Mutex
+	starts map[string][]time.Time
+}
+
+func newRateLimiter(limit int, per time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		per:    per,
+		starts: make(map[string][]time.Time),
+	}
+}
+
+// allow records a ceremony of the initiator unless it already started limit
+// ceremonies within the window
+func (l *rateLimiter) allow(initiator string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	starts := l.starts[initiator]
+	i := 0
+	for i < len(starts) && now.Sub(starts[i]) >= l.per {
+		i++
+	}
+	starts = starts[i:]
+	if len(starts) >= l.limit {
+		l.starts[initiator] = starts
+		return false
+	}
+	l.starts[initiator] = append(starts, now)
+	return true
+}
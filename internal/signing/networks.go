@@ -0,0 +1,111 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package signing
+
+import (
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Domain types of the messages the validator key signs, see the consensus specs
+var (
+	DomainVoluntaryExit      = phase0.DomainType{0x04, 0x00, 0x00, 0x00}
+	DomainApplicationBuilder = phase0.DomainType{0x00, 0x00, 0x00, 0x01}
+)
+
+// BeaconNetwork holds what the signing domains of a network are computed from
+type BeaconNetwork struct {
+	Name               string
+	GenesisForkVersion phase0.Version
+	// CapellaForkVersion signs voluntary exits, which stay valid across later
+	// forks since EIP-7044
+	CapellaForkVersion    phase0.Version
+	GenesisValidatorsRoot phase0.Root
+}
+
+var networks = map[string]*BeaconNetwork{
+	"mainnet": {
+		Name:               "mainnet",
+		GenesisForkVersion: phase0.Version{0x00, 0x00, 0x00, 0x00},
+		CapellaForkVersion: phase0.Version{0x03, 0x00, 0x00, 0x00},
+		GenesisValidatorsRoot: phase0.Root{
+			0x4b, 0x36, 0x3d, 0xb9, 0x4e, 0x28, 0x61, 0x20, 0xd7, 0x6e, 0xb9, 0x05, 0x34, 0x0f, 0xdd, 0x4e,
+			0x54, 0xbf, 0xe9, 0xf0, 0x6b, 0xf3, 0x3f, 0xf6, 0xcf, 0x5a, 0xd2, 0x7f, 0x51, 0x1b, 0xfe, 0x95,
+		},
+	},
+	"prater": {
+		Name:               "prater",
+		GenesisForkVersion: phase0.Version{0x00, 0x00, 0x10, 0x20},
+		CapellaForkVersion: phase0.Version{0x03, 0x00, 0x10, 0x20},
+		GenesisValidatorsRoot: phase0.Root{
+			0x04, 0x3d, 0xb0, 0xd9, 0xa8, 0x38, 0x13, 0x55, 0x1e, 0xe2, 0xf3, 0x34, 0x50, 0xd2, 0x37, 0x97,
+			0x75, 0x7d, 0x43, 0x09, 0x11, 0xa9, 0x32, 0x05, 0x30, 0xad, 0x8a, 0x0e, 0xab, 0xc4, 0x3e, 0xfb,
+		},
+	},
+	"holesky": {
+		Name:               "holesky",
+		GenesisForkVersion: phase0.Version{0x01, 0x01, 0x70, 0x00},
+		CapellaForkVersion: phase0.Version{0x04, 0x01, 0x70, 0x00},
+		GenesisValidatorsRoot: phase0.Root{
+			0x91, 0x43, 0xaa, 0x7c, 0x61, 0x5a, 0x7f, 0x71, 0x15, 0xe2, 0xb6, 0xaa, 0xc3, 0x19, 0xc0, 0x35,
+			0x29, 0xdf, 0x82, 0x42, 0xae, 0x70, 0x5f, 0xba, 0x9d, 0xf3, 0x9b, 0x79, 0xc5, 0x9f, 0xa8, 0xb1,
+		},
+	},
+}
+
+// Network returns the beacon network by name, mainnet, prater or holesky
+func Network(name string) (*BeaconNetwork, error) {
+	network, ok := networks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown beacon network %q, must be mainnet, prater or holesky", name)
+	}
+	return network, nil
+}
+
+// computeDomain is compute_domain of the consensus specs
+func computeDomain(domainType phase0.DomainType, forkVersion phase0.Version, genesisValidatorsRoot phase0.Root) (phase0.Domain, error) {
+	forkDataRoot, err := (&phase0.ForkData{
+		CurrentVersion:        forkVersion,
+		GenesisValidatorsRoot: genesisValidatorsRoot,
+	}).HashTreeRoot()
+	if err != nil {
+		return phase0.Domain{}, err
+	}
+
+	domain := phase0.Domain{}
+	copy(domain[:], domainType[:])
+	copy(domain[4:], forkDataRoot[:28])
+	return domain, nil
+}
+
+// computeSigningRoot is compute_signing_root of the consensus specs
+func computeSigningRoot(objectRoot [32]byte, domain phase0.Domain) ([]byte, error) {
+	root, err := (&phase0.SigningData{
+		ObjectRoot: objectRoot,
+		Domain:     domain,
+	}).HashTreeRoot()
+	if err != nil {
+		return nil, err
+	}
+	return root[:], nil
+}
@@ -0,0 +1,226 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package signing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/wealdtech/go-merkletree/keccak256"
+)
+
+// Types of payloads the validator key signs. None of them is slashable.
+const (
+	TypeSSVOwnerNonce         = "ssv_owner_nonce"
+	TypeVoluntaryExit         = "voluntary_exit"
+	TypeValidatorRegistration = "validator_registration"
+	TypeShareConfirmation     = "share_confirmation"
+)
+
+var (
+	ErrUntyped      = errors.New("keysign request has no payload to compute the signing root from")
+	ErrRootMismatch = errors.New("signing root of the keysign request doesn't match its payload")
+)
+
+// IsType returns whether typ is a known payload type
+func IsType(typ string) bool {
+	switch typ {
+	case TypeSSVOwnerNonce, TypeVoluntaryExit, TypeValidatorRegistration, TypeShareConfirmation:
+		return true
+	default:
+		return false
+	}
+}
+
+// Payload is the message a keysign request signs. Exactly the field of its
+// type is set.
+type Payload struct {
+	Type string `json:"type"`
+	// Network is the beacon network the voluntary exit or validator registration
+	// is signed for, mainnet, prater or holesky
+	Network               string                       `json:"network,omitempty"`
+	OwnerNonce            *OwnerNonce                  `json:"owner_nonce,omitempty"`
+	VoluntaryExit         *phase0.VoluntaryExit        `json:"voluntary_exit,omitempty"`
+	ValidatorRegistration *apiv1.ValidatorRegistration `json:"validator_registration,omitempty"`
+	ShareConfirmation     *ShareConfirmation           `json:"share_confirmation,omitempty"`
+}
+
+// OwnerNonce is the message SSV requires to be signed by the validator key when
+// its key shares are registered, keccak256("<owner address>:<nonce>")
+type OwnerNonce struct {
+	Owner string `json:"owner"`
+	Nonce uint64 `json:"nonce"`
+}
+
+// ShareConfirmation confirms the key shares a resharing or refresh produced.
+// Signed by the validator key with the new shares, it proves to the nodes that
+// the new shares work before they delete the ones they held before.
+type ShareConfirmation struct {
+	RequestID    string                      `json:"request_id"`
+	SharePubKeys map[types.OperatorID]string `json:"share_pub_keys"`
+}
+
+// OperatorIDs returns the operators of the confirmed shares in order
+func (sc *ShareConfirmation) OperatorIDs() []types.OperatorID {
+	operators := make([]types.OperatorID, 0, len(sc.SharePubKeys))
+	for operatorID := range sc.SharePubKeys {
+		operators = append(operators, operatorID)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+	return operators
+}
+
+// root is sha256 of the validator key, the request ID and the share public
+// keys in the order of the operators
+func (sc *ShareConfirmation) root(validatorPK types.ValidatorPK) ([]byte, error) {
+	if sc.RequestID == "" || len(sc.SharePubKeys) == 0 {
+		return nil, fmt.Errorf("share confirmation without request_id or share_pub_keys")
+	}
+	msg := fmt.Sprintf("%s:%x:%s", TypeShareConfirmation, []byte(validatorPK), strings.ToLower(sc.RequestID))
+	for _, operatorID := range sc.OperatorIDs() {
+		msg += fmt.Sprintf(":%d=%s", operatorID, strings.ToLower(strings.TrimPrefix(sc.SharePubKeys[operatorID], "0x")))
+	}
+	root := sha256.Sum256([]byte(msg))
+	return root[:], nil
+}
+
+// SigningRoot computes the root the validator key signs for the payload
+func (p *Payload) SigningRoot(validatorPK types.ValidatorPK) ([]byte, error) {
+	switch p.Type {
+	case TypeSSVOwnerNonce:
+		if p.OwnerNonce == nil {
+			return nil, fmt.Errorf("%s payload without owner_nonce", p.Type)
+		}
+		if !common.IsHexAddress(p.OwnerNonce.Owner) {
+			return nil, fmt.Errorf("invalid owner address %s", p.OwnerNonce.Owner)
+		}
+		owner := common.HexToAddress(p.OwnerNonce.Owner).Hex()
+		return keccak256.New().Hash([]byte(fmt.Sprintf("%s:%d", owner, p.OwnerNonce.Nonce))), nil
+
+	case TypeVoluntaryExit:
+		if p.VoluntaryExit == nil {
+			return nil, fmt.Errorf("%s payload without voluntary_exit", p.Type)
+		}
+		network, err := Network(p.Network)
+		if err != nil {
+			return nil, err
+		}
+		domain, err := computeDomain(DomainVoluntaryExit, network.CapellaForkVersion, network.GenesisValidatorsRoot)
+		if err != nil {
+			return nil, err
+		}
+		objectRoot, err := p.VoluntaryExit.HashTreeRoot()
+		if err != nil {
+			return nil, err
+		}
+		return computeSigningRoot(objectRoot, domain)
+
+	case TypeValidatorRegistration:
+		registration := p.ValidatorRegistration
+		if registration == nil {
+			return nil, fmt.Errorf("%s payload without validator_registration", p.Type)
+		}
+		if !bytes.Equal(registration.Pubkey[:], validatorPK) {
+			return nil, fmt.Errorf("validator registration of %x can't be signed by validator %x", registration.Pubkey[:], validatorPK)
+		}
+		network, err := Network(p.Network)
+		if err != nil {
+			return nil, err
+		}
+		// builder registrations are valid on every fork and don't commit to the chain
+		domain, err := computeDomain(DomainApplicationBuilder, network.GenesisForkVersion, phase0.Root{})
+		if err != nil {
+			return nil, err
+		}
+		objectRoot, err := registration.HashTreeRoot()
+		if err != nil {
+			return nil, err
+		}
+		return computeSigningRoot(objectRoot, domain)
+
+	case TypeShareConfirmation:
+		if p.ShareConfirmation == nil {
+			return nil, fmt.Errorf("%s payload without share_confirmation", p.Type)
+		}
+		return p.ShareConfirmation.root(validatorPK)
+
+	default:
+		return nil, fmt.Errorf("unknown payload type %q", p.Type)
+	}
+}
+
+// KeySign is a dkg.KeySign carrying the payload its signing root is computed
+// from. It encodes to the same json with an additional payload field, so the
+// dkg node still decodes it as a plain dkg.KeySign.
+type KeySign struct {
+	dkg.KeySign
+	Payload *Payload `json:"payload,omitempty"`
+}
+
+// NewKeySign builds the keysign request of the payload
+func NewKeySign(validatorPK types.ValidatorPK, payload *Payload) (*KeySign, error) {
+	root, err := payload.SigningRoot(validatorPK)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySign{
+		KeySign: dkg.KeySign{
+			ValidatorPK: validatorPK,
+			SigningRoot: root,
+		},
+		Payload: payload,
+	}, nil
+}
+
+func (ks *KeySign) Encode() ([]byte, error) {
+	return json.Marshal(ks)
+}
+
+func (ks *KeySign) Decode(data []byte) error {
+	return json.Unmarshal(data, ks)
+}
+
+// Verify recomputes the signing root from the payload, so that a request can't
+// get an arbitrary root signed, e.g. of a block or an attestation
+func (ks *KeySign) Verify() error {
+	if ks.Payload == nil {
+		return ErrUntyped
+	}
+	root, err := ks.Payload.SigningRoot(ks.ValidatorPK)
+	if err != nil {
+		return fmt.Errorf("invalid %s payload: %w", ks.Payload.Type, err)
+	}
+	if !bytes.Equal(root, ks.SigningRoot) {
+		return fmt.Errorf("%w: expected %x for the %s payload, got %x", ErrRootMismatch, root, ks.Payload.Type, ks.SigningRoot)
+	}
+	return nil
+}
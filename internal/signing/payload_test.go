@@ -0,0 +1,102 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package signing
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilderDomain(t *testing.T) {
+	network, err := Network("mainnet")
+	require.NoError(t, err)
+	domain, err := computeDomain(DomainApplicationBuilder, network.GenesisForkVersion, phase0.Root{})
+	require.NoError(t, err)
+	require.Equal(t, "00000001f5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a9", hex.EncodeToString(domain[:]))
+}
+
+func TestKeySign(t *testing.T) {
+	pubKey := phase0.BLSPubKey{0xa1}
+	validatorPK := pubKey[:]
+
+	payloads := map[string]*Payload{
+		TypeSSVOwnerNonce: {
+			Type:       TypeSSVOwnerNonce,
+			OwnerNonce: &OwnerNonce{Owner: "0x535953b5a6040074948cf185eaa7d2abbd66808f", Nonce: 3},
+		},
+		TypeVoluntaryExit: {
+			Type:          TypeVoluntaryExit,
+			Network:       "holesky",
+			VoluntaryExit: &phase0.VoluntaryExit{Epoch: 256, ValidatorIndex: 1024},
+		},
+		TypeValidatorRegistration: {
+			Type:    TypeValidatorRegistration,
+			Network: "mainnet",
+			ValidatorRegistration: &apiv1.ValidatorRegistration{
+				GasLimit:  30000000,
+				Timestamp: time.Unix(1700000000, 0),
+				Pubkey:    pubKey,
+			},
+		},
+		TypeShareConfirmation: {
+			Type: TypeShareConfirmation,
+			ShareConfirmation: &ShareConfirmation{
+				RequestID:    "a1b2",
+				SharePubKeys: map[types.OperatorID]string{1: "0xab", 2: "cd"},
+			},
+		},
+	}
+
+	for typ, payload := range payloads {
+		t.Run(typ, func(t *testing.T) {
+			keySign, err := NewKeySign(validatorPK, payload)
+			require.NoError(t, err)
+			data, err := keySign.Encode()
+			require.NoError(t, err)
+
+			// the dkg node decodes the request as a plain keysign
+			plain := &dkg.KeySign{}
+			require.NoError(t, plain.Decode(data))
+			require.Equal(t, keySign.SigningRoot, plain.SigningRoot)
+
+			decoded := &KeySign{}
+			require.NoError(t, decoded.Decode(data))
+			require.NoError(t, decoded.Verify())
+
+			decoded.SigningRoot = make([]byte, 32)
+			require.ErrorIs(t, decoded.Verify(), ErrRootMismatch)
+		})
+	}
+
+	require.ErrorIs(t, (&KeySign{KeySign: dkg.KeySign{ValidatorPK: validatorPK, SigningRoot: make([]byte, 32)}}).Verify(), ErrUntyped)
+
+	// a validator registration can only be signed by its own validator key
+	_, err := NewKeySign(make([]byte, 48), payloads[TypeValidatorRegistration])
+	require.Error(t, err)
+}
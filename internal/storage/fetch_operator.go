@@ -23,7 +23,6 @@ package storage
 
 import (
 	"crypto/rsa"
-	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -35,17 +34,25 @@ import (
 	"os"
 	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/metrics"
+	"github.com/RockX-SG/frost-dkg-demo/internal/tlsconfig"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 )
 
 func FetchOperatorByID(operatorID types.OperatorID) (*dkg.Operator, error) {
+	return FetchOperatorFromNetwork(OperatorRegistryNetwork(), operatorID)
+}
+
+// FetchOperatorFromNetwork looks the operator up in the registry of the
+// network, regardless of the configured registry network
+func FetchOperatorFromNetwork(network string, operatorID types.OperatorID) (*dkg.Operator, error) {
 	// Note, this is just for testing, to be removed before moving to staging
 	if isUsingHardcodedOperators() {
 		return hardCodedOperatorInfo(operatorID)
 	}
 
-	operator, err := GetOperatorFromRegistryByID(operatorID)
+	operator, err := GetOperatorFromRegistryByID(network, operatorID)
 	if err != nil {
 		return nil, err
 	}
@@ -68,20 +75,63 @@ type operatorResponse struct {
 	PublicKey string `json:"public_key"`
 }
 
-func GetOperatorFromRegistryByID(operatorID types.OperatorID) (*operatorResponse, error) {
+func GetOperatorFromRegistryByID(network string, operatorID types.OperatorID) (*operatorResponse, error) {
+	start := time.Now()
+	defer func() { metrics.RegistryFetchDuration.Observe(time.Since(start).Seconds()) }()
+
 	var operator = new(operatorResponse)
-	respBody, err := getResponse(fmt.Sprintf("https://api.ssv.network/api/v4/%s/operators/%d", OperatorRegistryNetwork(), operatorID))
+	respBody, err := getResponse(fmt.Sprintf("https://api.ssv.network/api/v4/%s/operators/%d", RegistryNetwork(network), operatorID))
 	if err != nil {
+		metrics.RegistryFetchFailures.Inc()
 		return nil, err
 	}
 	if err := json.Unmarshal(respBody, operator); err != nil {
+		metrics.RegistryFetchFailures.Inc()
 		return nil, err
 	}
 	return operator, nil
 }
 
+// RegistryConfig selects where operators are looked up. The node sets it from
+// its config file, the OPERATOR_REGISTRY_NETWORK and USE_HARDCODED_OPERATORS
+// env vars are used when it isn't set.
+type RegistryConfig struct {
+	Network   string
+	Hardcoded bool
+	// Timeout of a registry request, DefaultRegistryTimeout if zero
+	Timeout time.Duration
+}
+
+const DefaultRegistryTimeout = 5 * time.Minute
+
+var registryConfig *RegistryConfig
+
+func ConfigureRegistry(cfg *RegistryConfig) {
+	registryConfig = cfg
+}
+
+// IsRegistryNetwork reports whether the network is known to the registry, an
+// empty network is mainnet
+func IsRegistryNetwork(network string) bool {
+	switch network {
+	case "", "mainnet", "prater", "goerli", "jato-v2", "holesky":
+		return true
+	default:
+		return false
+	}
+}
+
 func OperatorRegistryNetwork() string {
-	switch os.Getenv("OPERATOR_REGISTRY_NETWORK") {
+	network := os.Getenv("OPERATOR_REGISTRY_NETWORK")
+	if registryConfig != nil {
+		network = registryConfig.Network
+	}
+	return RegistryNetwork(network)
+}
+
+// RegistryNetwork returns the name of the registry of the network
+func RegistryNetwork(network string) string {
+	switch network {
 	case "prater", "goerli", "jato-v2":
 		return "prater"
 	case "holesky":
@@ -92,6 +142,9 @@ func OperatorRegistryNetwork() string {
 }
 
 func isUsingHardcodedOperators() bool {
+	if registryConfig != nil {
+		return registryConfig.Hardcoded
+	}
 	if os.Getenv("USE_HARDCODED_OPERATORS") == "true" ||
 		os.Getenv("USE_HARDCODED_OPERATORS") == "True" ||
 		os.Getenv("USE_HARDCODED_OPERATORS") == "T" ||
@@ -155,11 +208,15 @@ func PublicKeyToBase64(publicKey *rsa.PublicKey) (string, error) {
 }
 
 func getHttpClient() *http.Client {
+	timeout := DefaultRegistryTimeout
+	if registryConfig != nil && registryConfig.Timeout > 0 {
+		timeout = registryConfig.Timeout
+	}
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: tlsconfig.MustClientConfigFromEnv(),
 		IdleConnTimeout: 5 * time.Minute, // Close idle connections after 30 seconds
 	}
 
 	// Create an HTTP client with the custom transport
-	return &http.Client{Transport: tr, Timeout: 5 * time.Minute}
+	return &http.Client{Transport: tr, Timeout: timeout}
 }
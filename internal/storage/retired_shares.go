@@ -0,0 +1,217 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+)
+
+const (
+	retiredSharePrefix = "retired-share/"
+	resharingPrefix    = "resharing/"
+)
+
+var (
+	ErrShareRetired    = errors.New("key share of the validator is retired")
+	ErrShareNotRetired = errors.New("key share of the validator has to be retired before it is deleted")
+	ErrRetireRefused   = errors.New("resharing doesn't retire the key share")
+)
+
+// RetiredShares tracks the key shares of operators that left the cluster of a
+// validator by a resharing. A retired share isn't used for signing or
+// resharing anymore and can be deleted.
+type RetiredShares struct {
+	db *badger.DB
+}
+
+// RetiredShare is the record of a retired key share, kept after the share is
+// deleted
+type RetiredShare struct {
+	RequestID string     `json:"request_id"`
+	RetiredAt time.Time  `json:"retired_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func NewRetiredShares(db *badger.DB) *RetiredShares {
+	return &RetiredShares{db: db}
+}
+
+func retiredShareKey(validatorPK types.ValidatorPK) []byte {
+	return []byte(retiredSharePrefix + hex.EncodeToString(validatorPK))
+}
+
+// Get returns the retirement record of the share of the validator, or nil if
+// it isn't retired
+func (s *RetiredShares) Get(validatorPK types.ValidatorPK) (*RetiredShare, error) {
+	var retired *RetiredShare
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(retiredShareKey(validatorPK))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		retired = &RetiredShare{}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, retired)
+		})
+	})
+	return retired, err
+}
+
+func resharingKey(requestID string) []byte {
+	return []byte(resharingPrefix + requestID)
+}
+
+// RecordResharing keeps the reshare request the node joined, a share is only
+// retired by a resharing the node recorded
+func (s *RetiredShares) RecordResharing(requestID string, reshare *dkg.Reshare) error {
+	val, err := json.Marshal(reshare)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(resharingKey(requestID), val)
+	})
+}
+
+// checkResharing refuses to retire the share unless the resharing requestID
+// was of the validator, left the operator out of the new cluster and the
+// confirmed shares are of its new operators
+func checkResharing(txn *badger.Txn, validatorPK types.ValidatorPK, requestID string, operatorID types.OperatorID, confirmed []types.OperatorID) error {
+	item, err := txn.Get(resharingKey(requestID))
+	if err == badger.ErrKeyNotFound {
+		return fmt.Errorf("%w: node didn't join resharing %s", ErrRetireRefused, requestID)
+	} else if err != nil {
+		return err
+	}
+	reshare := &dkg.Reshare{}
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, reshare)
+	}); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(reshare.ValidatorPK, validatorPK) {
+		return fmt.Errorf("%w: resharing %s was of validator %x", ErrRetireRefused, requestID, []byte(reshare.ValidatorPK))
+	}
+	for _, id := range reshare.OperatorIDs {
+		if id == operatorID {
+			return fmt.Errorf("%w: operator %d is in the new cluster of resharing %s", ErrRetireRefused, operatorID, requestID)
+		}
+	}
+	operators := append([]types.OperatorID{}, reshare.OperatorIDs...)
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+	if !reflect.DeepEqual(operators, confirmed) {
+		return fmt.Errorf("%w: confirmed shares of operators %v aren't the new cluster %v of resharing %s", ErrRetireRefused, confirmed, operators, requestID)
+	}
+	return nil
+}
+
+// Retire marks the share of the validator as retired by the resharing
+// requestID, which has to have left the operator out. The caller verified the
+// confirmation of the new shares of the operators confirmed, in order.
+// Retiring a retired share again keeps the first record.
+func (s *RetiredShares) Retire(validatorPK types.ValidatorPK, requestID string, operatorID types.OperatorID, confirmed []types.OperatorID) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(validatorPK); err != nil {
+			return fmt.Errorf("failed to get key share of validator %x: %w", validatorPK, err)
+		}
+		if err := checkResharing(txn, validatorPK, requestID, operatorID, confirmed); err != nil {
+			return err
+		}
+		if _, err := txn.Get(retiredShareKey(validatorPK)); err == nil {
+			return nil
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		val, err := json.Marshal(&RetiredShare{RequestID: requestID, RetiredAt: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		return txn.Set(retiredShareKey(validatorPK), val)
+	})
+}
+
+// Delete removes the retired share of the validator and the shares it
+// superseded. Deleted keys stay in the tables of badger until they are
+// compacted, so the keys are dropped from the tables instead.
+func (s *RetiredShares) Delete(validatorPK types.ValidatorPK) error {
+	retired, err := s.Get(validatorPK)
+	if err != nil {
+		return err
+	}
+	if retired == nil {
+		return ErrShareNotRetired
+	}
+
+	if err := s.db.DropPrefix(validatorPK, supersededSharePrefixOf(validatorPK)); err != nil {
+		return fmt.Errorf("failed to drop key shares of validator %x: %w", validatorPK, err)
+	}
+
+	now := time.Now().UTC()
+	retired.DeletedAt = &now
+	val, err := json.Marshal(retired)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(retiredShareKey(validatorPK), val)
+	})
+}
+
+// ShareInfo describes the key share a node holds of a validator without the
+// share itself
+type ShareInfo struct {
+	ValidatorPK string             `json:"validator_pk"`
+	SharePubKey string             `json:"share_pub_key"`
+	Threshold   uint64             `json:"threshold"`
+	OperatorIDs []types.OperatorID `json:"operator_ids"`
+	Retired     *RetiredShare      `json:"retired,omitempty"`
+}
+
+func NewShareInfo(output *dkg.KeyGenOutput, retired *RetiredShare) *ShareInfo {
+	info := &ShareInfo{
+		ValidatorPK: hex.EncodeToString(output.ValidatorPK),
+		SharePubKey: output.Share.GetPublicKey().SerializeToHexStr(),
+		Threshold:   output.Threshold,
+		OperatorIDs: make([]types.OperatorID, 0, len(output.OperatorPubKeys)),
+		Retired:     retired,
+	}
+	for operatorID := range output.OperatorPubKeys {
+		info.OperatorIDs = append(info.OperatorIDs, operatorID)
+	}
+	sort.Slice(info.OperatorIDs, func(i, j int) bool { return info.OperatorIDs[i] < info.OperatorIDs[j] })
+	return info
+}
@@ -0,0 +1,86 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetiredShares(t *testing.T) {
+	require.NoError(t, bls.Init(bls.BLS12_381))
+	require.NoError(t, bls.SetETHmode(bls.EthModeDraft07))
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+	s := NewStorage(db, 1, nil)
+	retired := NewRetiredShares(db)
+
+	validatorPK := make(types.ValidatorPK, 48)
+	newCluster := []types.OperatorID{2, 3, 4, 5}
+	require.Error(t, retired.Retire(validatorPK, "request-1", 1, newCluster))
+
+	for i := 0; i < 2; i++ {
+		share := &bls.SecretKey{}
+		share.SetByCSPRNG()
+		require.NoError(t, s.SaveKeyGenOutput(&dkg.KeyGenOutput{Share: share, OperatorPubKeys: map[types.OperatorID]*bls.PublicKey{}, ValidatorPK: validatorPK, Threshold: 3}))
+	}
+	require.ErrorIs(t, retired.Delete(validatorPK), ErrShareNotRetired)
+
+	// only a resharing of the validator the node joined, that left it out, retires the share
+	otherPK := make(types.ValidatorPK, 48)
+	otherPK[0] = 1
+	require.NoError(t, retired.RecordResharing("request-1", &dkg.Reshare{ValidatorPK: validatorPK, OperatorIDs: []types.OperatorID{2, 3, 4, 5}}))
+	require.NoError(t, retired.RecordResharing("request-2", &dkg.Reshare{ValidatorPK: validatorPK, OperatorIDs: []types.OperatorID{1, 2, 3, 4}}))
+	require.NoError(t, retired.RecordResharing("request-3", &dkg.Reshare{ValidatorPK: otherPK, OperatorIDs: []types.OperatorID{2, 3, 4, 5}}))
+	require.NoError(t, retired.RecordResharing("request-4", &dkg.Reshare{ValidatorPK: validatorPK, OperatorIDs: []types.OperatorID{2, 3, 4, 6}}))
+	require.ErrorIs(t, retired.Retire(validatorPK, "unknown", 1, newCluster), ErrRetireRefused)
+	require.ErrorIs(t, retired.Retire(validatorPK, "request-2", 1, []types.OperatorID{1, 2, 3, 4}), ErrRetireRefused)
+	require.ErrorIs(t, retired.Retire(validatorPK, "request-3", 1, newCluster), ErrRetireRefused)
+	// the confirmed shares have to be of the new cluster of the resharing
+	require.ErrorIs(t, retired.Retire(validatorPK, "request-1", 1, []types.OperatorID{2, 3, 4}), ErrRetireRefused)
+	record, err := retired.Get(validatorPK)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	require.NoError(t, retired.Retire(validatorPK, "request-1", 1, newCluster))
+	require.NoError(t, retired.Retire(validatorPK, "request-4", 1, []types.OperatorID{2, 3, 4, 6}))
+	record, err = retired.Get(validatorPK)
+	require.NoError(t, err)
+	require.Equal(t, "request-1", record.RequestID)
+
+	require.NoError(t, retired.Delete(validatorPK))
+	_, err = s.GetKeyGenOutput(validatorPK)
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+	count, err := NewSupersededShares(db).Count(validatorPK)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	record, err = retired.Get(validatorPK)
+	require.NoError(t, err)
+	require.NotNil(t, record.DeletedAt)
+}
@@ -0,0 +1,95 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+)
+
+const slashingProtectionPrefix = "slashing-protection/"
+
+var ErrSlashable = errors.New("refusing to sign a root that isn't of a non-slashable payload type")
+
+// SlashingProtection keeps the roots signed with the validator keys of the node
+// in its badger store. Only roots the node computed from a non-slashable
+// payload are signed, so block and attestation roots are refused, and a root
+// signed as one payload type is never signed as another.
+type SlashingProtection struct {
+	db *badger.DB
+}
+
+// SignedRoot is the record of a root signed by keysign
+type SignedRoot struct {
+	Type      string    `json:"type"`
+	RequestID string    `json:"request_id"`
+	SignedAt  time.Time `json:"signed_at"`
+}
+
+func NewSlashingProtection(db *badger.DB) *SlashingProtection {
+	return &SlashingProtection{db: db}
+}
+
+func slashingProtectionKey(validatorPK types.ValidatorPK, signingRoot []byte) []byte {
+	return []byte(fmt.Sprintf("%s%s/%s", slashingProtectionPrefix, hex.EncodeToString(validatorPK), hex.EncodeToString(signingRoot)))
+}
+
+// CheckAndRecord records the root unless it must not be signed. Signing the
+// same root as the same type again, e.g. when a ceremony is retried, is allowed.
+func (s *SlashingProtection) CheckAndRecord(validatorPK types.ValidatorPK, signingRoot []byte, typ, requestID string) error {
+	if !signing.IsType(typ) {
+		return fmt.Errorf("%w: %q", ErrSlashable, typ)
+	}
+
+	key := slashingProtectionKey(validatorPK, signingRoot)
+	return s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == nil {
+			signed := &SignedRoot{}
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, signed)
+			}); err != nil {
+				return fmt.Errorf("failed to read signed root %x: %w", signingRoot, err)
+			}
+			if signed.Type != typ {
+				return fmt.Errorf("%w: root %x was signed as %s by request %s", ErrSlashable, signingRoot, signed.Type, signed.RequestID)
+			}
+			return nil
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		val, err := json.Marshal(&SignedRoot{Type: typ, RequestID: requestID, SignedAt: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, val)
+	})
+}
@@ -0,0 +1,46 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlashingProtection(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+	sp := NewSlashingProtection(db)
+
+	validatorPK := make([]byte, 48)
+	root := make([]byte, 32)
+
+	require.NoError(t, sp.CheckAndRecord(validatorPK, root, signing.TypeVoluntaryExit, "request-1"))
+	// a retried ceremony signs the same root again
+	require.NoError(t, sp.CheckAndRecord(validatorPK, root, signing.TypeVoluntaryExit, "request-2"))
+	require.ErrorIs(t, sp.CheckAndRecord(validatorPK, root, signing.TypeSSVOwnerNonce, "request-3"), ErrSlashable)
+	require.ErrorIs(t, sp.CheckAndRecord(validatorPK, make([]byte, 32), "attestation", "request-4"), ErrSlashable)
+}
@@ -161,6 +161,11 @@ func (s *Storage) SaveKeyGenOutput(output *dkg.KeyGenOutput) error {
 	}
 
 	return s.db.Update(func(txn *badger.Txn) error {
+		// a resharing or refresh replaces the share, the old one is kept until
+		// the new shares are confirmed
+		if err := archiveKeyGenOutput(txn, output.ValidatorPK, value); err != nil {
+			return fmt.Errorf("failed to keep superseded key share :: %s", err.Error())
+		}
 		return txn.Set([]byte(output.ValidatorPK), value)
 	})
 }
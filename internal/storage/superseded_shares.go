@@ -0,0 +1,126 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+)
+
+const supersededSharePrefix = "superseded-share/"
+
+var ErrShareMismatch = errors.New("key share of the node doesn't match the confirmed share public key")
+
+// SupersededShares keeps the key shares that a resharing or refresh replaced.
+// They are kept until the new shares of all operators are confirmed, since a
+// validator can't sign with a mix of old and new shares.
+type SupersededShares struct {
+	db *badger.DB
+}
+
+func NewSupersededShares(db *badger.DB) *SupersededShares {
+	return &SupersededShares{db: db}
+}
+
+func supersededSharePrefixOf(validatorPK types.ValidatorPK) []byte {
+	return []byte(fmt.Sprintf("%s%s/", supersededSharePrefix, hex.EncodeToString(validatorPK)))
+}
+
+// archiveKeyGenOutput keeps the stored keygen output of the validator before
+// it is overwritten by value
+func archiveKeyGenOutput(txn *badger.Txn, validatorPK types.ValidatorPK, value []byte) error {
+	item, err := txn.Get(validatorPK)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	old, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(old, value) {
+		return nil
+	}
+	key := append(supersededSharePrefixOf(validatorPK), []byte(fmt.Sprintf("%020d", time.Now().UnixNano()))...)
+	return txn.Set(key, old)
+}
+
+// Count returns the number of superseded shares kept of the validator
+func (s *SupersededShares) Count(validatorPK types.ValidatorPK) (int, error) {
+	count := 0
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: supersededSharePrefixOf(validatorPK)})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Delete removes the superseded shares of the validator once the share the
+// node holds now is confirmed to have the public key sharePubKey, and returns
+// the number of shares deleted
+func (s *SupersededShares) Delete(validatorPK types.ValidatorPK, sharePubKey string) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(validatorPK)
+		if err != nil {
+			return fmt.Errorf("failed to get key share of validator %x: %w", validatorPK, err)
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		output, err := (&KeyGenOutput{}).Decode(val)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal keygen output :: %s", err.Error())
+		}
+		if current := output.Share.GetPublicKey().SerializeToHexStr(); current != strings.ToLower(strings.TrimPrefix(sharePubKey, "0x")) {
+			return fmt.Errorf("%w: share public key is %s", ErrShareMismatch, current)
+		}
+
+		keys := make([][]byte, 0)
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: supersededSharePrefixOf(validatorPK)})
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	return deleted, err
+}
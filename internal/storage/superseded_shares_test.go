@@ -0,0 +1,72 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupersededShares(t *testing.T) {
+	require.NoError(t, bls.Init(bls.BLS12_381))
+	require.NoError(t, bls.SetETHmode(bls.EthModeDraft07))
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+	s := NewStorage(db, 1, nil)
+	superseded := NewSupersededShares(db)
+
+	validatorPK := make(types.ValidatorPK, 48)
+	output := func() *dkg.KeyGenOutput {
+		share := &bls.SecretKey{}
+		share.SetByCSPRNG()
+		return &dkg.KeyGenOutput{Share: share, OperatorPubKeys: map[types.OperatorID]*bls.PublicKey{}, ValidatorPK: validatorPK, Threshold: 3}
+	}
+	old, refreshed := output(), output()
+
+	require.NoError(t, s.SaveKeyGenOutput(old))
+	require.NoError(t, s.SaveKeyGenOutput(old))
+	count, err := superseded.Count(validatorPK)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	require.NoError(t, s.SaveKeyGenOutput(refreshed))
+	count, err = superseded.Count(validatorPK)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// the node only lets go of the old share once it holds the confirmed one
+	_, err = superseded.Delete(validatorPK, old.Share.GetPublicKey().SerializeToHexStr())
+	require.ErrorIs(t, err, ErrShareMismatch)
+	deleted, err := superseded.Delete(validatorPK, "0x"+refreshed.Share.GetPublicKey().SerializeToHexStr())
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	count, err = superseded.Count(validatorPK)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
@@ -0,0 +1,197 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// client side TLS is configured the same way for the cli, the node and the messenger
+const (
+	EnvCAFile             = "TLS_CA_FILE"
+	EnvCertFile           = "TLS_CERT_FILE"
+	EnvKeyFile            = "TLS_KEY_FILE"
+	EnvInsecureSkipVerify = "TLS_INSECURE_SKIP_VERIFY"
+)
+
+type ClientOptions struct {
+	// CAFile is a pem bundle of CAs trusted in addition to the system roots
+	CAFile string
+	// CertFile and KeyFile are the client certificate presented to servers that require mTLS
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification, never use it in production
+	InsecureSkipVerify bool
+}
+
+func ClientOptionsFromEnv() (*ClientOptions, error) {
+	opts := &ClientOptions{
+		CAFile:   os.Getenv(EnvCAFile),
+		CertFile: os.Getenv(EnvCertFile),
+		KeyFile:  os.Getenv(EnvKeyFile),
+	}
+	if insecure := os.Getenv(EnvInsecureSkipVerify); insecure != "" {
+		skip, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", EnvInsecureSkipVerify, err)
+		}
+		opts.InsecureSkipVerify = skip
+	}
+	return opts, nil
+}
+
+func (opts *ClientOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if err := appendCertsFromFile(pool, opts.CAFile); err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// ClientConfigFromEnv builds the client TLS config from TLS_* env vars.
+// Certificates are verified unless TLS_INSECURE_SKIP_VERIFY is explicitly set.
+func ClientConfigFromEnv() (*tls.Config, error) {
+	opts, err := ClientOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return opts.Config()
+}
+
+// MustClientConfigFromEnv is ClientConfigFromEnv for constructors that can't
+// return an error. Services validate the env with ClientConfigFromEnv on startup.
+func MustClientConfigFromEnv() *tls.Config {
+	config, err := ClientConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
+
+type ServerOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mTLS, client certificates must be signed by one of these CAs
+	ClientCAFile string
+	// RequireClientCert rejects connections without a client certificate during
+	// the handshake. Otherwise a certificate is only verified if one is given
+	// and handlers decide which routes require it.
+	RequireClientCert bool
+}
+
+func (opts *ServerOptions) Enabled() bool {
+	return opts != nil && opts.CertFile != ""
+}
+
+func (opts *ServerOptions) Config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if opts.ClientCAFile != "" {
+		pool := x509.NewCertPool()
+		if err := appendCertsFromFile(pool, opts.ClientCAFile); err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		if opts.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return config, nil
+}
+
+// NewServer returns a server for Serve, serving plain http if no server
+// certificate is configured
+func NewServer(addr string, handler http.Handler, opts *ServerOptions) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	if !opts.Enabled() {
+		return srv, nil
+	}
+
+	config, err := opts.Config()
+	if err != nil {
+		return nil, err
+	}
+	srv.TLSConfig = config
+	return srv, nil
+}
+
+// Serve blocks until the server fails or is shut down, which isn't an error
+func Serve(srv *http.Server) error {
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func appendCertsFromFile(pool *x509.CertPool, path string) error {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in CA file %s", path)
+	}
+	return nil
+}
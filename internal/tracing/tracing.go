@@ -0,0 +1,189 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EnvExporter selects the span exporter: otlp, stdout or none. The otlp
+// exporter is configured with the standard OTEL_EXPORTER_OTLP_* env vars,
+// e.g. OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318
+const EnvExporter = "OTEL_TRACES_EXPORTER"
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+
+	instrumentationName = "github.com/RockX-SG/frost-dkg-demo"
+)
+
+// RequestIDKey is set on every span of a ceremony so that its spans can be
+// found across the cli, the messenger and the nodes
+const RequestIDKey = attribute.Key("dkg.request_id")
+
+func RequestID(requestID string) attribute.KeyValue {
+	return RequestIDKey.String(requestID)
+}
+
+// Init sets up the global tracer provider from the env. Tracing stays a no-op
+// unless an exporter is configured. The returned func flushes pending spans.
+func Init(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch os.Getenv(EnvExporter) {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	default:
+		return nil, fmt.Errorf("unknown %s %s, use %s, %s or %s", EnvExporter, os.Getenv(EnvExporter), ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create span exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "rockx-dkg-"+serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Inject adds the trace context of ctx to the headers of an outgoing request
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// EndWithError records the error, if any, on the span and ends it
+func EndWithError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for every request, continuing the trace of
+// the caller if the request carries a trace context
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := Tracer().Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", c.Request.Method),
+				attribute.String("http.route", route),
+			),
+		)
+		defer span.End()
+
+		if requestID := c.Param("request_id"); requestID != "" {
+			span.SetAttributes(RequestID(requestID))
+		} else if requestID := c.Query("request_id"); requestID != "" {
+			span.SetAttributes(RequestID(requestID))
+		} else if topicName := c.Query("topic_name"); topicName != "" {
+			span.SetAttributes(RequestID(topicName))
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// ceremonies keeps the current trace context of the ceremonies of this process
+// by request ID. The dkg protocol calls the network without a context, so the
+// network looks the context up by the request ID of the message instead.
+var ceremonies = struct {
+	sync.RWMutex
+	ctx map[string]context.Context
+}{ctx: make(map[string]context.Context)}
+
+// SetCeremonyContext keeps the span of ctx as the parent of later spans and
+// requests of the ceremony. Only the span is kept, not the cancellation of ctx.
+func SetCeremonyContext(requestID string, ctx context.Context) {
+	ceremonies.Lock()
+	defer ceremonies.Unlock()
+	ceremonies.ctx[requestID] = trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
+
+// CeremonyContext returns the trace context of the ceremony or an empty
+// context if this process doesn't trace it
+func CeremonyContext(requestID string) context.Context {
+	ceremonies.RLock()
+	defer ceremonies.RUnlock()
+	if ctx, ok := ceremonies.ctx[requestID]; ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+func EndCeremony(requestID string) {
+	ceremonies.Lock()
+	defer ceremonies.Unlock()
+	delete(ceremonies.ctx, requestID)
+}
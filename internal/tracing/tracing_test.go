@@ -0,0 +1,74 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCeremonyContextPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.POST("/publish", func(c *gin.Context) { c.Status(http.StatusOK) })
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	requestID := "0102"
+	ctx, span := Tracer().Start(context.Background(), "cli.keygen")
+	SetCeremonyContext(requestID, ctx)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/publish?topic_name="+requestID, nil)
+	require.NoError(t, err)
+	Inject(CeremonyContext(requestID), req.Header)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	server := spans[0]
+	require.Equal(t, "POST /publish", server.Name())
+	require.Equal(t, span.SpanContext().TraceID(), server.SpanContext().TraceID())
+	require.Equal(t, span.SpanContext().SpanID(), server.Parent().SpanID())
+	require.Contains(t, server.Attributes(), RequestID(requestID))
+
+	// once the ceremony is over its requests aren't traced anymore
+	EndCeremony(requestID)
+	require.False(t, trace.SpanContextFromContext(CeremonyContext(requestID)).IsValid())
+}
@@ -0,0 +1,169 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Entry is a single recorded message of a ceremony. Data holds the raw
+// SSVMessage exactly as it was published so that it can be replayed.
+type Entry struct {
+	Timestamp time.Time           `json:"timestamp"`
+	Topic     string              `json:"topic"`
+	Signer    types.OperatorID    `json:"signer"`
+	MsgType   dkg.MsgType         `json:"msg_type"`
+	Round     frost.ProtocolRound `json:"round"`
+	Relayed   bool                `json:"relayed"`
+	Error     string              `json:"error,omitempty"`
+	Data      []byte              `json:"data"`
+}
+
+// NewEntry decodes as much of the message as it can. Undecodable messages are
+// still recorded, with the decoding error.
+func NewEntry(topic string, data []byte, relayed bool) *Entry {
+	entry := &Entry{
+		Timestamp: time.Now().UTC(),
+		Topic:     topic,
+		Relayed:   relayed,
+		Data:      data,
+	}
+
+	signedMsg, protocolMsg, err := Decode(data)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if signedMsg != nil {
+		entry.Signer = signedMsg.Signer
+		entry.MsgType = signedMsg.Message.MsgType
+	}
+	if protocolMsg != nil {
+		entry.Round = protocolMsg.Round
+	}
+	return entry
+}
+
+// Decode unwraps a published SSVMessage. The protocol message is only returned
+// for messages of type dkg.ProtocolMsgType.
+func Decode(data []byte) (*dkg.SignedMessage, *frost.ProtocolMsg, error) {
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(data); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode ssv message: %w", err)
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode signed message: %w", err)
+	}
+	if signedMsg.Message == nil {
+		return nil, nil, fmt.Errorf("signed message from %d has no message", signedMsg.Signer)
+	}
+	if signedMsg.Message.MsgType != dkg.ProtocolMsgType {
+		return signedMsg, nil, nil
+	}
+	protocolMsg := &frost.ProtocolMsg{}
+	if err := protocolMsg.Decode(signedMsg.Message.Data); err != nil {
+		return signedMsg, nil, fmt.Errorf("failed to decode protocol message: %w", err)
+	}
+	return signedMsg, protocolMsg, nil
+}
+
+// Writer appends entries of a single topic to a JSON lines file
+type Writer struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewWriter(dir, topic string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	path, err := Path(dir, topic)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{file: file}, nil
+}
+
+// Path returns the transcript file of the topic in dir. Topics are hex
+// request IDs, any other name is refused so that it can't leave dir.
+func Path(dir, topic string) (string, error) {
+	if topic == "" || strings.Trim(topic, "0123456789abcdefABCDEF") != "" {
+		return "", fmt.Errorf("invalid topic name %q", topic)
+	}
+	return filepath.Join(dir, fmt.Sprintf("transcript_%s.jsonl", topic)), nil
+}
+
+func (w *Writer) Append(entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.file.Write(append(line, '\n'))
+	return err
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+func Read(path string) ([]*Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]*Entry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("failed to parse transcript line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
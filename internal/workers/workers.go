@@ -23,20 +23,80 @@ package workers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
 type Ctxlog string
 
+// RestartPolicy decides whether the runner starts a job again once it returned
+type RestartPolicy int
+
+const (
+	// RestartNever leaves a failed job stopped
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure restarts a job that returned an error or panicked
+	RestartOnFailure
+	// RestartAlways restarts a job whenever it returns until it is cancelled
+	RestartAlways
+)
+
+// Job is run until it returns or its context is cancelled, which jobs must
+// honor so that Cancel and Shutdown can stop them
 type Job struct {
-	ID string
-	Fn func(*context.Context)
+	ID      string
+	Fn      func(ctx context.Context) error
+	Restart RestartPolicy
+	// MaxRestarts limits the restarts of the job, unlimited if zero
+	MaxRestarts int
+}
+
+type JobState string
+
+const (
+	JobRunning    JobState = "running"
+	JobRestarting JobState = "restarting"
+	JobFailed     JobState = "failed"
+)
+
+type JobStatus struct {
+	ID        string    `json:"id"`
+	State     JobState  `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type jobEntry struct {
+	job    *Job
+	cancel context.CancelFunc
+	status JobStatus
 }
 
+// Runner supervises the jobs. Panics are recovered and reported as failures,
+// failed jobs are restarted according to their policy. Jobs that are done are
+// forgotten, failed jobs that aren't restarted anymore are kept for Jobs.
 type Runner struct {
 	incomingJobs chan *Job
-	jobs         map[string]context.CancelFunc
+	stopped      chan struct{}
+	stopOnce     sync.Once
+
+	mu      sync.Mutex
+	jobs    map[string]*jobEntry
+	running sync.WaitGroup
 
 	logger *logrus.Logger
 }
@@ -44,24 +104,188 @@ type Runner struct {
 func NewRunner(logger *logrus.Logger) *Runner {
 	return &Runner{
 		incomingJobs: make(chan *Job, 10),
-		jobs:         make(map[string]context.CancelFunc),
+		stopped:      make(chan struct{}),
+		jobs:         make(map[string]*jobEntry),
 		logger:       logger,
 	}
 }
 
+// AddJob queues the job, jobs added after Shutdown are never started
 func (r *Runner) AddJob(j *Job) {
-	r.incomingJobs <- j
+	select {
+	case r.incomingJobs <- j:
+	case <-r.stopped:
+		r.logger.Warnf("Runner: not starting job %s while shutting down", j.ID)
+	}
 }
 
 func (r *Runner) Run() {
-	for job := range r.incomingJobs {
-		ctxlog := context.WithValue(context.Background(), Ctxlog("logger"), r.logger)
-		ctx, cancel := context.WithCancel(ctxlog)
-		r.jobs[job.ID] = cancel
-		go job.Fn(&ctx)
+	for {
+		select {
+		case <-r.stopped:
+			return
+		case job := <-r.incomingJobs:
+			r.start(job)
+		}
+	}
+}
+
+func (r *Runner) start(job *Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Shutdown may have cancelled the running jobs meanwhile
+	select {
+	case <-r.stopped:
+		return
+	default:
+	}
+
+	ctxlog := context.WithValue(context.Background(), Ctxlog("logger"), r.logger)
+	ctx, cancel := context.WithCancel(ctxlog)
+	entry := &jobEntry{
+		job:    job,
+		cancel: cancel,
+		status: JobStatus{ID: job.ID, State: JobRunning, StartedAt: time.Now()},
+	}
+	// a job replacing one with the same ID, e.g. of a recreated topic, stops the old one
+	if old, ok := r.jobs[job.ID]; ok {
+		old.cancel()
+	}
+	r.jobs[job.ID] = entry
+
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		r.supervise(ctx, entry)
+	}()
+}
+
+func (r *Runner) supervise(ctx context.Context, entry *jobEntry) {
+	job := entry.job
+	log := r.logger.WithField("job", job.ID)
+
+	for {
+		err := runJob(ctx, job)
+		if ctx.Err() != nil || (err == nil && job.Restart != RestartAlways) {
+			r.forget(entry)
+			return
+		}
+
+		if err != nil {
+			log.Errorf("Runner: job %s failed: %v", job.ID, err)
+		}
+		r.mu.Lock()
+		if err != nil {
+			entry.status.LastError = err.Error()
+		}
+		if job.Restart == RestartNever || (job.MaxRestarts > 0 && entry.status.Restarts >= job.MaxRestarts) {
+			entry.status.State = JobFailed
+			entry.cancel()
+			r.mu.Unlock()
+			log.Errorf("Runner: job %s stopped after %d restarts", job.ID, entry.status.Restarts)
+			return
+		}
+		entry.status.State = JobRestarting
+		delay := restartDelay(entry.status.Restarts)
+		r.mu.Unlock()
+
+		log.Warnf("Runner: restarting job %s in %s", job.ID, delay)
+		select {
+		case <-ctx.Done():
+			r.forget(entry)
+			return
+		case <-time.After(delay):
+		}
+
+		r.mu.Lock()
+		entry.status.Restarts++
+		entry.status.State = JobRunning
+		entry.status.StartedAt = time.Now()
+		r.mu.Unlock()
+	}
+}
+
+// runJob runs the job once and turns a panic into an error
+func runJob(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+	return job.Fn(ctx)
+}
+
+func restartDelay(restarts int) time.Duration {
+	delay := minRestartDelay
+	for i := 0; i < restarts && delay < maxRestartDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRestartDelay {
+		delay = maxRestartDelay
 	}
+	return delay
 }
 
-func (r *Runner) Cancel(id string) {
-	r.jobs[id]()
+func (r *Runner) forget(entry *jobEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.jobs[entry.job.ID] == entry {
+		delete(r.jobs, entry.job.ID)
+	}
+}
+
+// Cancel cancels the context of the job, which is forgotten once it returns
+func (r *Runner) Cancel(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.jobs[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	entry.cancel()
+	// failed jobs don't return anymore
+	if entry.status.State == JobFailed {
+		delete(r.jobs, id)
+	}
+	return nil
+}
+
+// Jobs returns the status of the running, restarting and failed jobs
+func (r *Runner) Jobs() []JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(r.jobs))
+	for _, entry := range r.jobs {
+		statuses = append(statuses, entry.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
+}
+
+// Shutdown stops starting new jobs, cancels the context of every running job
+// and waits for the jobs to return until ctx is done
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		close(r.stopped)
+		for _, entry := range r.jobs {
+			entry.cancel()
+		}
+		r.mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
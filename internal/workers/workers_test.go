@@ -0,0 +1,122 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package workers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRunner(t *testing.T) *Runner {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	r := NewRunner(logger)
+	go r.Run()
+	t.Cleanup(func() { r.Shutdown(context.Background()) })
+	return r
+}
+
+func jobStatus(r *Runner, id string) (JobStatus, bool) {
+	for _, status := range r.Jobs() {
+		if status.ID == id {
+			return status, true
+		}
+	}
+	return JobStatus{}, false
+}
+
+func TestRunnerRestartsPanickingJob(t *testing.T) {
+	r := newTestRunner(t)
+
+	var runs atomic.Int32
+	r.AddJob(&Job{
+		ID: "panics",
+		Fn: func(ctx context.Context) error {
+			if runs.Add(1) == 1 {
+				panic("boom")
+			}
+			<-ctx.Done()
+			return nil
+		},
+		Restart: RestartOnFailure,
+	})
+
+	require.Eventually(t, func() bool {
+		status, ok := jobStatus(r, "panics")
+		return ok && status.State == JobRunning && status.Restarts == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	status, _ := jobStatus(r, "panics")
+	require.Contains(t, status.LastError, "panic: boom")
+
+	require.NoError(t, r.Cancel("panics"))
+	require.Eventually(t, func() bool {
+		_, ok := jobStatus(r, "panics")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRunnerKeepsFailedJob(t *testing.T) {
+	r := newTestRunner(t)
+
+	r.AddJob(&Job{
+		ID: "fails",
+		Fn: func(ctx context.Context) error {
+			return errors.New("failed")
+		},
+	})
+
+	require.Eventually(t, func() bool {
+		status, ok := jobStatus(r, "fails")
+		return ok && status.State == JobFailed
+	}, time.Second, 10*time.Millisecond)
+
+	require.ErrorIs(t, r.Cancel("unknown"), ErrJobNotFound)
+	require.NoError(t, r.Cancel("fails"))
+	require.Empty(t, r.Jobs())
+}
+
+func TestRunnerShutdown(t *testing.T) {
+	r := newTestRunner(t)
+
+	started := make(chan struct{})
+	r.AddJob(&Job{
+		ID: "blocks",
+		Fn: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return nil
+		},
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, r.Shutdown(ctx))
+	require.Empty(t, r.Jobs())
+}